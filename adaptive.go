@@ -0,0 +1,162 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveLatencyTolerance is the factor by which the mean job duration
+	// may exceed the baseline before the concurrency is reduced.
+	adaptiveLatencyTolerance = 1.5
+
+	// adaptiveFailureTolerance is the increase of the failure rate (as a
+	// fraction of all jobs) which is tolerated before the concurrency is
+	// reduced.
+	adaptiveFailureTolerance = 0.1
+
+	// adaptiveSmoothing is the weight of the latest window when the baseline
+	// is updated.
+	adaptiveSmoothing = 0.2
+)
+
+// adaptiveLimit is an AIMD (additive increase, multiplicative decrease)
+// controller for the number of concurrently running jobs. The durations and
+// failures of all jobs finished since the limit was last changed are collected
+// in a window. When the window is full, the mean duration and failure rate are
+// compared to the baseline: if they degraded, the limit is halved, otherwise
+// it is increased by one. Until the first degradation is detected, the limit
+// is doubled instead (like the slow start in TCP).
+type adaptiveLimit struct {
+	m    sync.Mutex
+	cond *sync.Cond
+
+	limit, max int
+	active     int
+	slowStart  bool
+
+	// window of measurements since the last change of the limit
+	count    int
+	failures int
+	total    time.Duration
+
+	baseline         time.Duration
+	baselineFailRate float64
+}
+
+// newAdaptiveLimit returns an adaptiveLimit which allows at most max
+// concurrent jobs.
+func newAdaptiveLimit(max int) *adaptiveLimit {
+	a := &adaptiveLimit{
+		limit:     1,
+		max:       max,
+		slowStart: true,
+	}
+	a.cond = sync.NewCond(&a.m)
+
+	return a
+}
+
+// Acquire blocks until another job may be started.
+func (a *adaptiveLimit) Acquire() {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	for a.active >= a.limit {
+		a.cond.Wait()
+	}
+
+	a.active++
+}
+
+// Release records the result of a job which has been started after calling
+// Acquire, and adjusts the limit when enough jobs have finished.
+func (a *adaptiveLimit) Release(d time.Duration, failed bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.active--
+	a.count++
+	a.total += d
+
+	if failed {
+		a.failures++
+	}
+
+	if a.count >= a.limit {
+		a.adjust()
+	}
+
+	a.cond.Broadcast()
+}
+
+// Abort releases a slot obtained by Acquire when no job has been started.
+func (a *adaptiveLimit) Abort() {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.active--
+	a.cond.Broadcast()
+}
+
+// adjust evaluates the current window and changes the limit. The mutex must be
+// held by the caller.
+func (a *adaptiveLimit) adjust() {
+	mean := a.total / time.Duration(a.count)
+	failRate := float64(a.failures) / float64(a.count)
+
+	a.count, a.failures, a.total = 0, 0, 0
+
+	if a.baseline == 0 {
+		a.baseline = mean
+		a.baselineFailRate = failRate
+	}
+
+	degraded := float64(mean) > adaptiveLatencyTolerance*float64(a.baseline) ||
+		failRate > a.baselineFailRate+adaptiveFailureTolerance
+
+	if degraded {
+		a.slowStart = false
+
+		a.limit /= 2
+		if a.limit < 1 {
+			a.limit = 1
+		}
+
+		return
+	}
+
+	a.baseline = time.Duration(adaptiveSmoothing*float64(mean) + (1-adaptiveSmoothing)*float64(a.baseline))
+	a.baselineFailRate = adaptiveSmoothing*failRate + (1-adaptiveSmoothing)*a.baselineFailRate
+
+	if a.slowStart {
+		a.limit *= 2
+	} else {
+		a.limit++
+	}
+
+	if a.limit > a.max {
+		a.limit = a.max
+	}
+}
+
+// Limit returns the current number of concurrent jobs allowed.
+func (a *adaptiveLimit) Limit() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	return a.limit
+}
+
+// adaptive is set when the number of concurrent jobs is controlled
+// dynamically.
+var adaptive *adaptiveLimit
+
+// workerLimit returns the number of jobs which may currently run in parallel.
+func workerLimit() int {
+	if adaptive != nil {
+		return adaptive.Limit()
+	}
+
+	return opts.threads
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func runWindow(a *adaptiveLimit, d time.Duration, failed bool) {
+	n := a.Limit()
+	for i := 0; i < n; i++ {
+		a.Acquire()
+	}
+
+	for i := 0; i < n; i++ {
+		a.Release(d, failed)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	t.Parallel()
+
+	a := newAdaptiveLimit(20)
+
+	// slow start doubles the limit while everything is stable
+	for _, want := range []int{2, 4, 8, 16} {
+		runWindow(a, time.Second, false)
+
+		if a.Limit() != want {
+			t.Fatalf("slow start: want limit %v, got %v", want, a.Limit())
+		}
+	}
+
+	// failing jobs halve the limit
+	runWindow(a, time.Second, true)
+
+	if a.Limit() != 8 {
+		t.Fatalf("after failures: want limit 8, got %v", a.Limit())
+	}
+
+	// afterwards the limit is increased additively, up to the maximum
+	for i := 0; i < 20; i++ {
+		runWindow(a, time.Second, false)
+	}
+
+	if a.Limit() != 20 {
+		t.Fatalf("additive increase: want limit 20, got %v", a.Limit())
+	}
+
+	// slow jobs halve the limit as well
+	runWindow(a, 3*time.Second, false)
+
+	if a.Limit() != 10 {
+		t.Fatalf("after slow jobs: want limit 10, got %v", a.Limit())
+	}
+}
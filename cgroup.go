@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cgroupLimits are the resource limits applied to each job.
+type cgroupLimits struct {
+	// memory is the maximum memory usage in bytes
+	memory int64
+
+	// cpus is the maximum number of CPUs the job may use
+	cpus float64
+
+	// pids is the maximum number of processes and threads
+	pids int
+}
+
+// enabled returns true if at least one limit is set.
+func (l cgroupLimits) enabled() bool {
+	return l.memory > 0 || l.cpus > 0 || l.pids > 0
+}
+
+// parseBytes parses a size like "512M", "2GiB" or "4096".
+//
+//nolint:gomnd
+func parseBytes(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+
+	var factor int64 = 1
+
+	if str != "" {
+		if i := strings.IndexByte("KMGT", str[len(str)-1]); i >= 0 {
+			factor = 1 << (10 * (i + 1))
+			str = str[:len(str)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * float64(factor)), nil
+}
+
+// parseCPUQuota parses a number of CPUs like "1.5" or a percentage of a single
+// CPU like "50%".
+//
+//nolint:gomnd
+func parseCPUQuota(s string) (float64, error) {
+	str := strings.TrimSuffix(s, "%")
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid CPU quota %q", s)
+	}
+
+	if str != s {
+		n /= 100
+	}
+
+	return n, nil
+}
+
+// parseLimits returns the limits for jobs set on the command line.
+func parseLimits() (cgroupLimits, error) {
+	var (
+		limits cgroupLimits
+		err    error
+	)
+
+	if opts.memLimit != "" {
+		limits.memory, err = parseBytes(opts.memLimit)
+		if err != nil {
+			return limits, err
+		}
+	}
+
+	if opts.cpuQuota != "" {
+		limits.cpus, err = parseCPUQuota(opts.cpuQuota)
+		if err != nil {
+			return limits, err
+		}
+	}
+
+	if opts.pidsLimit < 0 {
+		return limits, fmt.Errorf("invalid pids limit %d", opts.pidsLimit)
+	}
+
+	limits.pids = opts.pidsLimit
+
+	return limits, nil
+}
+
+// jobLimits are the resource limits for each job, set from the options.
+var jobLimits cgroupLimits
+
+// cgroups is set when jobs are run in cgroups with resource limits.
+var cgroups *cgroupManager
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cgroupMount = "/sys/fs/cgroup"
+
+// cgroupCPUPeriod is the period in microseconds used for the CPU quota.
+const cgroupCPUPeriod = 100000
+
+// cgroupManager creates a cgroup (version 2) for each job below a directory
+// which belongs to this machma process:
+//
+//	<parent>/machma-<pid>/supervisor   machma itself (if it was in <parent>)
+//	<parent>/machma-<pid>/job-<id>     one cgroup per job
+//
+// The parent cgroup must be delegated to the user, e.g. by running machma via
+// `systemd-run --user --scope -p Delegate=yes`.
+type cgroupManager struct {
+	limits cgroupLimits
+
+	parent string
+	base   string
+
+	// moved is true if machma moved itself to the supervisor cgroup
+	moved bool
+}
+
+// ownCgroup returns the cgroup of the current process.
+func ownCgroup() (string, error) {
+	buf, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+
+	return "", errors.New("cgroup v2 (unified hierarchy) is not available")
+}
+
+// writeCgroupFile writes value to an existing file in a cgroup directory.
+func writeCgroupFile(dir, name, value string) error {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(value)
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// controllers returns the cgroup controllers needed for the limits.
+func (l cgroupLimits) controllers() string {
+	var list []string
+
+	if l.memory > 0 {
+		list = append(list, "+memory")
+	}
+
+	if l.cpus > 0 {
+		list = append(list, "+cpu")
+	}
+
+	if l.pids > 0 {
+		list = append(list, "+pids")
+	}
+
+	return strings.Join(list, " ")
+}
+
+// newCgroupManager prepares the cgroups for the jobs below parent, which
+// defaults to the cgroup machma is running in.
+func newCgroupManager(parent string, limits cgroupLimits) (*cgroupManager, error) {
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	if parent == "" {
+		parent = own
+	}
+
+	m := &cgroupManager{
+		limits: limits,
+		parent: filepath.Join(cgroupMount, parent),
+	}
+	m.base = filepath.Join(m.parent, fmt.Sprintf("machma-%d", os.Getpid()))
+
+	// cgroup.controllers only exists in the cgroup v2 hierarchy
+	_, err = os.Stat(filepath.Join(m.parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a cgroup v2 directory: %w", m.parent, err)
+	}
+
+	err = os.Mkdir(m.base, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	// processes may only live in leaf cgroups when controllers are enabled, so
+	// move machma out of the parent cgroup
+	if filepath.Clean(parent) == filepath.Clean(own) {
+		supervisor := filepath.Join(m.base, "supervisor")
+
+		err = os.Mkdir(supervisor, 0755)
+		if err == nil {
+			err = writeCgroupFile(supervisor, "cgroup.procs", strconv.Itoa(os.Getpid()))
+		}
+
+		if err != nil {
+			m.Close()
+
+			return nil, fmt.Errorf("moving machma to a new cgroup failed: %w", err)
+		}
+
+		m.moved = true
+	}
+
+	for _, dir := range []string{m.parent, m.base} {
+		err = writeCgroupFile(dir, "cgroup.subtree_control", limits.controllers())
+		if err != nil {
+			m.Close()
+
+			return nil, fmt.Errorf("enabling cgroup controllers in %v failed (is the cgroup delegated?): %w", dir, err)
+		}
+	}
+
+	return m, nil
+}
+
+// Close removes all cgroups created by the manager.
+func (m *cgroupManager) Close() {
+	if m.moved {
+		_ = writeCgroupFile(m.parent, "cgroup.procs", strconv.Itoa(os.Getpid()))
+		_ = os.Remove(filepath.Join(m.base, "supervisor"))
+	}
+
+	_ = os.Remove(m.base)
+}
+
+// jobCgroup is the cgroup for a single job.
+type jobCgroup struct {
+	dir string
+}
+
+// Create returns a new cgroup with the configured limits for job id.
+func (m *cgroupManager) Create(id int) (*jobCgroup, error) {
+	g := &jobCgroup{dir: filepath.Join(m.base, fmt.Sprintf("job-%d", id))}
+
+	err := os.Mkdir(g.dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings [][2]string
+
+	if m.limits.memory > 0 {
+		settings = append(settings, [2]string{"memory.max", strconv.FormatInt(m.limits.memory, 10)})
+	}
+
+	if m.limits.cpus > 0 {
+		quota := int64(m.limits.cpus * cgroupCPUPeriod)
+		settings = append(settings, [2]string{"cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)})
+	}
+
+	if m.limits.pids > 0 {
+		settings = append(settings, [2]string{"pids.max", strconv.Itoa(m.limits.pids)})
+	}
+
+	for _, setting := range settings {
+		err = writeCgroupFile(g.dir, setting[0], setting[1])
+		if err != nil {
+			g.Remove()
+
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// Path returns the directory of the cgroup.
+func (g *jobCgroup) Path() string {
+	return g.dir
+}
+
+// joinCgroup moves the current process to the cgroup in dir.
+func joinCgroup(dir string) error {
+	return writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(os.Getpid()))
+}
+
+// OOMKilled returns true if a process in the cgroup was killed because the
+// memory limit was reached.
+func (g *jobCgroup) OOMKilled() bool {
+	f, err := os.Open(filepath.Join(g.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cgroupRemoveRetries is the number of attempts to remove a job cgroup, which
+// fails while processes are still exiting.
+const cgroupRemoveRetries = 10
+
+// Remove kills all remaining processes in the cgroup and removes it.
+func (g *jobCgroup) Remove() {
+	// cgroup.kill is only available on Linux 5.14 and later
+	_ = writeCgroupFile(g.dir, "cgroup.kill", "1")
+
+	for i := 0; i < cgroupRemoveRetries; i++ {
+		if os.Remove(g.dir) == nil {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,31 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+type cgroupManager struct{}
+
+func newCgroupManager(parent string, limits cgroupLimits) (*cgroupManager, error) {
+	return nil, errors.New("resource limits for jobs are only supported on Linux")
+}
+
+func (m *cgroupManager) Close() {}
+
+type jobCgroup struct{}
+
+func (m *cgroupManager) Create(id int) (*jobCgroup, error) {
+	return nil, errors.New("resource limits for jobs are only supported on Linux")
+}
+
+func (g *jobCgroup) Path() string { return "" }
+
+func joinCgroup(dir string) error {
+	return errors.New("resource limits for jobs are only supported on Linux")
+}
+
+func (g *jobCgroup) OOMKilled() bool { return false }
+
+func (g *jobCgroup) Remove() {}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+)
+
+var bytesTests = []struct {
+	input string
+	n     int64
+	err   bool
+}{
+	{"4096", 4096, false},
+	{"512M", 512 << 20, false},
+	{"2GiB", 2 << 30, false},
+	{"1.5k", 1536, false},
+	{"", 0, true},
+	{"foo", 0, true},
+	{"-1G", 0, true},
+}
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range bytesTests {
+		n, err := parseBytes(test.input)
+		if test.err != (err != nil) {
+			t.Errorf("test %d failed: unexpected error value %v", i, err)
+
+			continue
+		}
+
+		if n != test.n {
+			t.Errorf("test %d failed: want %v, got %v", i, test.n, n)
+		}
+	}
+}
+
+var cpuQuotaTests = []struct {
+	input string
+	cpus  float64
+	err   bool
+}{
+	{"1.5", 1.5, false},
+	{"50%", 0.5, false},
+	{"200%", 2, false},
+	{"0", 0, true},
+	{"%", 0, true},
+}
+
+func TestParseCPUQuota(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range cpuQuotaTests {
+		cpus, err := parseCPUQuota(test.input)
+		if test.err != (err != nil) {
+			t.Errorf("test %d failed: unexpected error value %v", i, err)
+
+			continue
+		}
+
+		if cpus != test.cpus {
+			t.Errorf("test %d failed: want %v, got %v", i, test.cpus, cpus)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// durationHeap is a min-heap of durations, it implements heap.Interface.
+type durationHeap []time.Duration
+
+func (h durationHeap) Len() int           { return len(h) }
+func (h durationHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h durationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *durationHeap) Push(x interface{}) {
+	*h = append(*h, x.(time.Duration))
+}
+
+func (h *durationHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return d
+}
+
+// durationStats collects the durations of all finished jobs. The running
+// median is kept in two heaps, so adding a duration takes O(log n).
+type durationStats struct {
+	m sync.Mutex
+
+	// lower holds the smaller half of the durations negated (so the largest
+	// one is at the top), upper the larger half. lower has as many elements
+	// as upper or one more.
+	lower durationHeap
+	upper durationHeap
+
+	n   int
+	sum time.Duration
+}
+
+// Add records the duration of a finished job.
+func (s *durationStats) Add(d time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if len(s.lower) == 0 || d <= -s.lower[0] {
+		heap.Push(&s.lower, -d)
+	} else {
+		heap.Push(&s.upper, d)
+	}
+
+	switch {
+	case len(s.lower) > len(s.upper)+1:
+		heap.Push(&s.upper, -heap.Pop(&s.lower).(time.Duration))
+	case len(s.upper) > len(s.lower):
+		heap.Push(&s.lower, -heap.Pop(&s.upper).(time.Duration))
+	}
+
+	s.n++
+	s.sum += d
+}
+
+// Mean returns the mean duration, or zero if no job has finished yet.
+func (s *durationStats) Mean() time.Duration {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.n == 0 {
+		return 0
+	}
+
+	return s.sum / time.Duration(s.n)
+}
+
+// Median returns the median duration and the number of durations recorded.
+func (s *durationStats) Median() (time.Duration, int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.n == 0 {
+		return 0, 0
+	}
+
+	if s.n%2 == 1 {
+		return -s.lower[0], s.n
+	}
+
+	return (-s.lower[0] + s.upper[0]) / 2, s.n
+}
+
+// jobDurations contains the durations of all jobs finished in this run.
+var jobDurations durationStats
+
+// deadline is the time at which all running jobs are cancelled, jobs which
+// would not finish before the deadline are not started any more.
+var deadline time.Time
+
+// parseUntil returns the next point in time after now with the given time of
+// day, formatted as 15:04 or 15:04:05.
+func parseUntil(s string, now time.Time) (time.Time, error) {
+	var (
+		t   time.Time
+		err error
+	)
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		t, err = time.ParseInLocation(layout, s, now.Location())
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 06:00", s)
+	}
+
+	t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// beyondDeadline returns true if a job started now would probably not finish
+// before the deadline, judging from the mean duration of the jobs finished so
+// far.
+func beyondDeadline() bool {
+	if deadline.IsZero() {
+		return false
+	}
+
+	return time.Now().Add(jobDurations.Mean()).After(deadline)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+var untilTests = []struct {
+	input  string
+	now    time.Time
+	output time.Time
+}{
+	{
+		"06:00",
+		time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 6, 6, 0, 0, 0, time.UTC),
+	},
+	{
+		"23:30:15",
+		time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 5, 23, 30, 15, 0, time.UTC),
+	},
+	{
+		"22:00",
+		time.Date(2021, 1, 5, 22, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 6, 22, 0, 0, 0, time.UTC),
+	},
+}
+
+func TestParseUntil(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range untilTests {
+		output, err := parseUntil(test.input, test.now)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+
+			continue
+		}
+
+		if !output.Equal(test.output) {
+			t.Errorf("test %d failed: want %v, got %v", i, test.output, output)
+		}
+	}
+
+	_, err := parseUntil("25:00", time.Now())
+	if err == nil {
+		t.Errorf("expected error for invalid time, got none")
+	}
+}
+
+func TestDurationStats(t *testing.T) {
+	t.Parallel()
+
+	var s durationStats
+
+	if median, n := s.Median(); median != 0 || n != 0 {
+		t.Fatalf("empty stats: want median 0 of 0 items, got %v of %v", median, n)
+	}
+
+	for _, d := range []time.Duration{5, 1, 3} {
+		s.Add(d * time.Second)
+	}
+
+	if median, n := s.Median(); median != 3*time.Second || n != 3 {
+		t.Errorf("want median 3s of 3 items, got %v of %v", median, n)
+	}
+
+	s.Add(7 * time.Second)
+
+	if median, _ := s.Median(); median != 4*time.Second {
+		t.Errorf("want median 4s, got %v", median)
+	}
+
+	if mean := s.Mean(); mean != 4*time.Second {
+		t.Errorf("want mean 4s, got %v", mean)
+	}
+}
+
+func TestDurationStatsMedian(t *testing.T) {
+	t.Parallel()
+
+	var tests = [][]time.Duration{
+		{1},
+		{2, 1},
+		{1, 1, 1, 1},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1},
+		{1, 100, 2, 99, 3, 98, 4},
+		{5, 3, 8, 3, 9, 1, 3, 7, 2, 6},
+	}
+
+	for i, test := range tests {
+		var s durationStats
+
+		for j, d := range test {
+			s.Add(d)
+
+			sorted := append([]time.Duration(nil), test[:j+1]...)
+			sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+
+			want := sorted[len(sorted)/2]
+			if len(sorted)%2 == 0 {
+				want = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+			}
+
+			median, n := s.Median()
+			if median != want || n != j+1 {
+				t.Errorf("test %d failed after %d items: want %v, got %v of %v", i, j+1, want, median, n)
+			}
+		}
+	}
+}
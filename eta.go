@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// runningJob describes a job which is currently running.
+type runningJob struct {
+	start  time.Time
+	weight float64
+
+	// fraction is the completion of the job extracted by --progress-regex,
+	// hasProgress is set once it is known
+	fraction    float64
+	hasProgress bool
+
+	// slot is the worker running the job, tag the item and message the last
+	// message of the job, they are shown in the status lines
+	slot    int
+	tag     string
+	message string
+}
+
+// moments accumulates the mean and variance of a series of values.
+type moments struct {
+	n          int
+	sum, sumSq float64
+}
+
+// Add records a value.
+func (m *moments) Add(x float64) {
+	m.n++
+	m.sum += x
+	m.sumSq += x * x
+}
+
+// Mean returns the mean of all values.
+func (m moments) Mean() float64 {
+	if m.n == 0 {
+		return 0
+	}
+
+	return m.sum / float64(m.n)
+}
+
+// Stddev returns the sample standard deviation of all values.
+func (m moments) Stddev() float64 {
+	if m.n < 2 { //nolint:gomnd
+		return 0
+	}
+
+	mean := m.Mean()
+
+	v := (m.sumSq - float64(m.n)*mean*mean) / float64(m.n-1)
+	if v < 0 {
+		return 0
+	}
+
+	return math.Sqrt(v)
+}
+
+// runState describes the state of a run for an estimator. The amount of work
+// is measured in items, or in the weight of the items with --weight-by.
+type runState struct {
+	now time.Time
+
+	// processed is the work done by the finished jobs
+	processed float64
+
+	// perUnit contains the durations in seconds per unit of work of the
+	// finished jobs
+	perUnit moments
+
+	// avgWeight is the average weight of all items
+	avgWeight float64
+
+	running map[int]*runningJob
+	workers int
+}
+
+// completed returns the work done so far, including the completed fraction of
+// running jobs.
+func (s runState) completed() float64 {
+	completed := s.processed
+
+	for _, job := range s.running {
+		if job.hasProgress {
+			completed += job.fraction * job.weight
+		}
+	}
+
+	return completed
+}
+
+// estimator estimates the remaining time of a run.
+type estimator interface {
+	// Report tells the estimator about the current state of the run.
+	Report(s runState)
+
+	// ETA returns the estimated remaining time and the margin of error, which
+	// is zero if it is not known.
+	ETA() (time.Duration, time.Duration)
+}
+
+// estimators contains the constructors for all estimators selectable with
+// --eta, they are called with the start of the run, the total amount of work
+// and an initial estimate of the time per unit of work (zero if unknown).
+var estimators = map[string]func(start time.Time, total float64, seed time.Duration) estimator{
+	"parallel": func(start time.Time, total float64, seed time.Duration) estimator {
+		// the durations of previous runs are part of runState.perUnit
+		return newParallelEstimator(total)
+	},
+	"ewma": func(start time.Time, total float64, seed time.Duration) estimator {
+		e := newEWMA(start, total)
+		e.perItem = seed
+
+		return e
+	},
+	"median": func(start time.Time, total float64, seed time.Duration) estimator {
+		m := newMedianWindow(start, total, medianWindowSize)
+		if seed > 0 {
+			m.window = append(m.window, seed)
+		}
+
+		return m
+	},
+}
+
+// checkEstimator returns an error if there is no estimator with the name.
+func checkEstimator(name string) error {
+	if _, ok := estimators[name]; !ok {
+		return fmt.Errorf("unknown estimator %q for --eta, valid are: parallel, ewma, median", name)
+	}
+
+	return nil
+}
+
+// medianWindowSize is the number of measurements used by the median estimator.
+const medianWindowSize = 20
+
+// medianWindow estimates the time per unit of work as the median of the last
+// measurements, so that single very fast or slow items do not have much
+// influence.
+type medianWindow struct {
+	total     float64
+	completed float64
+
+	last time.Time
+
+	// window contains the last measurements of the time per unit of work
+	window []time.Duration
+	size   int
+}
+
+// newMedianWindow returns a medianWindow for the total amount of work which
+// keeps size measurements.
+func newMedianWindow(start time.Time, total float64, size int) *medianWindow {
+	return &medianWindow{
+		total: total,
+		last:  start,
+		size:  size,
+	}
+}
+
+// Report tells the estimator about the current state of the run.
+func (m *medianWindow) Report(s runState) {
+	m.report(s.now, s.completed())
+}
+
+func (m *medianWindow) report(now time.Time, completed float64) {
+	if completed <= m.completed {
+		return
+	}
+
+	perUnit := time.Duration(float64(now.Sub(m.last)) / (completed - m.completed))
+
+	m.completed = completed
+	m.last = now
+
+	m.window = append(m.window, perUnit)
+	if len(m.window) > m.size {
+		m.window = m.window[1:]
+	}
+}
+
+// ETA returns the estimated remaining time.
+func (m *medianWindow) ETA() (time.Duration, time.Duration) {
+	if len(m.window) == 0 {
+		return 0, 0
+	}
+
+	sorted := make([]time.Duration, len(m.window))
+	copy(sorted, m.window)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2 //nolint:gomnd
+	}
+
+	return time.Duration((m.total - m.completed) * float64(median)), 0
+}
+
+// etaConfidence is the number of standard deviations used as the margin of
+// error of the ETA, which corresponds to a confidence of 95%.
+const etaConfidence = 1.96
+
+// parallelEstimator estimates the remaining time from the durations of the
+// finished jobs, taking into account how long the running jobs have been
+// running already and how many jobs run in parallel.
+type parallelEstimator struct {
+	total float64
+	state runState
+}
+
+// newParallelEstimator returns a parallelEstimator for the total amount of
+// work.
+func newParallelEstimator(total float64) *parallelEstimator {
+	return &parallelEstimator{total: total}
+}
+
+// Report tells the estimator about the current state of the run.
+func (p *parallelEstimator) Report(s runState) {
+	p.state = s
+}
+
+// ETA returns the estimated remaining time and the margin of error.
+func (p *parallelEstimator) ETA() (time.Duration, time.Duration) {
+	s := p.state
+	if s.perUnit.n == 0 {
+		return 0, 0
+	}
+
+	mean := s.perUnit.Mean()
+	stddev := s.perUnit.Stddev()
+
+	// the work which has not been started yet
+	queued := p.total - s.processed
+
+	// the remaining time of the running jobs, in seconds
+	var busy, longest float64
+
+	for _, job := range s.running {
+		queued -= job.weight
+
+		expected := job.weight * mean
+		elapsed := s.now.Sub(job.start).Seconds()
+
+		if job.hasProgress && job.fraction > 0 {
+			expected = elapsed / job.fraction
+		}
+
+		remaining := math.Max(expected-elapsed, 0)
+
+		busy += remaining
+		longest = math.Max(longest, remaining)
+	}
+
+	queued = math.Max(queued, 0)
+
+	workers := float64(s.workers)
+	if workers < 1 {
+		workers = 1
+	}
+
+	// all workers are busy until the queue is empty, but the run cannot end
+	// before the longest running job has finished
+	eta := math.Max((busy+queued*mean)/workers, longest)
+
+	// the variance of the sum of the durations of the queued jobs, plus the
+	// uncertainty of the mean itself
+	variance := stddev * stddev * queued * s.avgWeight
+	variance += queued * queued * stddev * stddev / float64(s.perUnit.n)
+
+	margin := etaConfidence * math.Sqrt(variance) / workers
+
+	return seconds(eta), seconds(margin)
+}
+
+// seconds converts a number of seconds to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMedianWindow(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	m := newMedianWindow(start, 100, 5)
+
+	if eta, _ := m.ETA(); eta != 0 {
+		t.Errorf("want no ETA without measurements, got %v", eta)
+	}
+
+	// one unit per second, except for a single very slow unit
+	now := start
+	for i, d := range []time.Duration{1, 1, 30, 1, 1} {
+		now = now.Add(d * time.Second)
+		m.report(now, float64(i+1))
+	}
+
+	if eta, _ := m.ETA(); eta != 95*time.Second {
+		t.Errorf("want ETA %v, got %v", 95*time.Second, eta)
+	}
+
+	// the completed work must not decrease
+	m.report(now.Add(time.Second), 3)
+
+	if eta, _ := m.ETA(); eta != 95*time.Second {
+		t.Errorf("want ETA %v, got %v", 95*time.Second, eta)
+	}
+
+	// older measurements are dropped
+	for i := 0; i < 5; i++ {
+		now = now.Add(2 * time.Second)
+		m.report(now, float64(6+i))
+	}
+
+	if eta, _ := m.ETA(); eta != 180*time.Second {
+		t.Errorf("want ETA %v, got %v", 180*time.Second, eta)
+	}
+}
+
+func TestMoments(t *testing.T) {
+	t.Parallel()
+
+	var m moments
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		m.Add(x)
+	}
+
+	if m.Mean() != 5 {
+		t.Errorf("want mean 5, got %v", m.Mean())
+	}
+
+	if stddev := m.Stddev(); math.Abs(stddev-2.138) > 0.001 {
+		t.Errorf("want stddev 2.138, got %v", stddev)
+	}
+}
+
+func TestParallelEstimator(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	var tests = []struct {
+		state  runState
+		eta    time.Duration
+		margin bool
+	}{
+		// nothing finished yet
+		{
+			state: runState{now: now, workers: 4},
+		},
+		// 8 of 20 items done in 10s each, 4 running for 5s: the running jobs
+		// need 5s more, then two rounds of 4 jobs
+		{
+			state: runState{
+				now:       now,
+				processed: 8,
+				perUnit:   moments{n: 8, sum: 80, sumSq: 800},
+				avgWeight: 1,
+				running: map[int]*runningJob{
+					1: {start: now.Add(-5 * time.Second), weight: 1},
+					2: {start: now.Add(-5 * time.Second), weight: 1},
+					3: {start: now.Add(-5 * time.Second), weight: 1},
+					4: {start: now.Add(-5 * time.Second), weight: 1},
+				},
+				workers: 4,
+			},
+			eta: 25 * time.Second,
+		},
+		// the last running job reports 25% progress after 10s
+		{
+			state: runState{
+				now:       now,
+				processed: 19,
+				perUnit:   moments{n: 19, sum: 190, sumSq: 1900},
+				avgWeight: 1,
+				running: map[int]*runningJob{
+					1: {start: now.Add(-10 * time.Second), weight: 1, fraction: 0.25, hasProgress: true},
+				},
+				workers: 4,
+			},
+			eta: 30 * time.Second,
+		},
+		// durations vary, so there is a margin of error
+		{
+			state: runState{
+				now:       now,
+				processed: 2,
+				perUnit:   moments{n: 2, sum: 20, sumSq: 250},
+				avgWeight: 1,
+				workers:   1,
+			},
+			eta:    180 * time.Second,
+			margin: true,
+		},
+	}
+
+	for i, test := range tests {
+		p := newParallelEstimator(20)
+		p.Report(test.state)
+
+		eta, margin := p.ETA()
+		if eta != test.eta {
+			t.Errorf("test %d failed: want %v, got %v", i, test.eta, eta)
+		}
+
+		if (margin > 0) != test.margin {
+			t.Errorf("test %d failed: want margin %v, got %v", i, test.margin, margin)
+		}
+	}
+}
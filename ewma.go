@@ -9,9 +9,9 @@ import (
 // https://github.com/dgryski/trifles/blob/master/ewmaest/ewmaest.go
 // https://stackoverflow.com/a/936720
 type ewma struct {
-	total         int
-	completed     int
-	lastCompleted int
+	total         float64
+	completed     float64
+	lastCompleted float64
 
 	start time.Time
 	last  time.Time
@@ -23,7 +23,7 @@ type ewma struct {
 
 // newEWMA returns a new EWMA for total items.
 //nolint:gomnd
-func newEWMA(start time.Time, totalItems int) *ewma {
+func newEWMA(start time.Time, totalItems float64) *ewma {
 	return &ewma{
 		start: start,
 		last:  start,
@@ -33,19 +33,22 @@ func newEWMA(start time.Time, totalItems int) *ewma {
 	}
 }
 
-// Report tells the ewma how many items have been processed.
-func (e *ewma) Report(totalCompletedItems int) {
+// Report tells the ewma how much work has been completed. Partially processed
+// items are reported as fractions.
+func (e *ewma) Report(s runState) {
+	totalCompletedItems := s.completed()
+
 	// return early if no new information is being reported
-	if totalCompletedItems == 0 || e.completed == totalCompletedItems {
+	if totalCompletedItems == 0 || totalCompletedItems <= e.completed {
 		return
 	}
 
 	e.completed = totalCompletedItems
 
-	lastBlockTime := time.Since(e.last)
-	e.last = time.Now()
+	lastBlockTime := s.now.Sub(e.last)
+	e.last = s.now
 
-	lastItemEstimate := lastBlockTime / time.Duration(e.completed-e.lastCompleted)
+	lastItemEstimate := time.Duration(float64(lastBlockTime) / (e.completed - e.lastCompleted))
 	e.lastCompleted = e.completed
 
 	// use the first measurement directly, without applying α
@@ -58,17 +61,17 @@ func (e *ewma) Report(totalCompletedItems int) {
 	e.perItem = time.Duration(e.α*float64(lastItemEstimate)) + time.Duration((1-e.α)*float64(e.perItem))
 }
 
-// ETA returns the estimated remaining time.
-func (e *ewma) ETA() time.Duration {
+// ETA returns the estimated remaining time, the margin of error is not known.
+func (e *ewma) ETA() (time.Duration, time.Duration) {
 	remaining := e.total - e.completed
 
 	perItem := e.perItem
 	if e.completed > 0 {
-		perItem = time.Duration(e.β * float64(e.last.Sub(e.start)) / float64(e.completed))
+		perItem = time.Duration(e.β * float64(e.last.Sub(e.start)) / e.completed)
 		perItem += time.Duration((1 - e.β) * float64(e.perItem))
 	}
 
-	d := time.Duration(remaining) * perItem
+	d := time.Duration(remaining * float64(perItem))
 
-	return d
+	return d, 0
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEWMAIgnoresNonIncreasing(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	e := newEWMA(start, 10)
+
+	var tests = []struct {
+		at        time.Duration
+		completed float64
+		perItem   time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{2 * time.Second, 2, time.Second},
+		// progress of a running job went back, e.g. because it restarted
+		{3 * time.Second, 1.5, time.Second},
+		// no new work
+		{4 * time.Second, 2, time.Second},
+		{4 * time.Second, 0, time.Second},
+		// the time since the last increase is used, 3s for one item
+		{5 * time.Second, 3, 1200 * time.Millisecond},
+	}
+
+	for i, test := range tests {
+		e.Report(runState{now: start.Add(test.at), processed: test.completed})
+
+		if e.perItem != test.perItem {
+			t.Errorf("test %d failed: want %v, got %v", i, test.perItem, e.perItem)
+		}
+	}
+
+	if e.completed != 3 {
+		t.Errorf("want completed 3, got %v", e.completed)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exitReason returns a short description of how a job has ended, used as the
+// key for the histogram of exit codes.
+func exitReason(res *Result) string {
+	switch {
+	case res.StartFailed:
+		return "start failed"
+	case res.Signal != "":
+		return res.Signal
+	case res.ExitCode >= 0:
+		return strconv.Itoa(res.ExitCode)
+	default:
+		return "other"
+	}
+}
+
+// exitHistogram counts how often jobs ended with each exit code or signal.
+type exitHistogram map[string]int
+
+// Print writes the histogram to w, exit codes are sorted numerically and
+// listed before the other reasons.
+func (h exitHistogram) Print(w io.Writer) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ci, erri := strconv.Atoi(keys[i])
+		cj, errj := strconv.Atoi(keys[j])
+
+		switch {
+		case erri == nil && errj == nil:
+			return ci < cj
+		case erri == nil:
+			return true
+		case errj == nil:
+			return false
+		default:
+			return keys[i] < keys[j]
+		}
+	})
+
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, fmt.Sprintf("%v: %d", k, h[k]))
+	}
+
+	fmt.Fprintf(w, "exit codes: %v\n", strings.Join(list, ", "))
+}
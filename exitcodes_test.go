@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+var exitReasonTests = []struct {
+	res    Result
+	reason string
+}{
+	{Result{ExitCode: 0}, "0"},
+	{Result{ExitCode: 3}, "3"},
+	{Result{ExitCode: -1, Signal: "killed"}, "killed"},
+	{Result{ExitCode: -1, StartFailed: true}, "start failed"},
+	{Result{ExitCode: -1}, "other"},
+}
+
+func TestExitReason(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range exitReasonTests {
+		res := test.res
+
+		reason := exitReason(&res)
+		if reason != test.reason {
+			t.Errorf("test %d failed: want %q, got %q", i, test.reason, reason)
+		}
+	}
+}
+
+var exitHistogramTests = []struct {
+	h      exitHistogram
+	output string
+}{
+	{exitHistogram{"0": 5}, "exit codes: 0: 5\n"},
+	{exitHistogram{"10": 1, "2": 3, "0": 7}, "exit codes: 0: 7, 2: 3, 10: 1\n"},
+	{
+		exitHistogram{"terminated": 1, "1": 2, "killed": 4, "start failed": 1, "0": 3},
+		"exit codes: 0: 3, 1: 2, killed: 4, start failed: 1, terminated: 1\n",
+	},
+	{exitHistogram{"other": 1, "killed": 2}, "exit codes: killed: 2, other: 1\n"},
+}
+
+func TestExitHistogramPrint(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range exitHistogramTests {
+		var buf bytes.Buffer
+
+		test.h.Print(&buf)
+
+		if buf.String() != test.output {
+			t.Errorf("test %d failed: want %q, got %q", i, test.output, buf.String())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// failure describes a failed job for the summary at the end.
+type failure struct {
+	tag    string
+	reason string
+
+	// message is the last line the job printed to stderr, or the final error
+	// message if it did not print anything to stderr
+	message string
+}
+
+// printFailures writes the list of failed items to w.
+func printFailures(w io.Writer, failures []failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "failed items:\n")
+
+	for _, f := range failures {
+		reason := f.reason
+		if _, err := strconv.Atoi(reason); err == nil {
+			reason = "exit code " + reason
+		}
+
+		fmt.Fprintf(w, "  %v [%v] %v\n", colorTag(f.tag), reason, colorError(f.message))
+	}
+}
+
+// writeFailedItems writes the items of all failed jobs to a file, in the same
+// format as the input so that it can be used to retry them.
+func writeFailedItems(filename string, failures []failure) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	separator := "\n"
+	if opts.useNullSeparator {
+		separator = "\x00"
+	}
+
+	wr := bufio.NewWriter(f)
+
+	for _, failure := range failures {
+		_, err = wr.WriteString(failure.tag + separator)
+		if err != nil {
+			_ = f.Close()
+
+			return err
+		}
+	}
+
+	err = wr.Flush()
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
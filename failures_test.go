@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFailedItemsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	defer func(stdin *os.File, null bool, placeholder string) {
+		os.Stdin, opts.useNullSeparator, opts.placeholder = stdin, null, placeholder
+	}(os.Stdin, opts.useNullSeparator, opts.placeholder)
+
+	opts.placeholder = "{}"
+
+	var tests = []struct {
+		null  bool
+		items []string
+	}{
+		{false, []string{"a.jpg", "dir/with space.jpg", "host:22"}},
+		{false, []string{"only one"}},
+		{true, []string{"a.jpg", "line\nbreak.jpg", "tab\there"}},
+		{true, []string{"x"}},
+	}
+
+	for i, test := range tests {
+		opts.useNullSeparator = test.null
+
+		failures := make([]failure, 0, len(test.items))
+		for _, item := range test.items {
+			failures = append(failures, failure{tag: item, reason: "1"})
+		}
+
+		filename := filepath.Join(dir, "failed")
+
+		err = writeFailedItems(filename, failures)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Stdin = f
+
+		ch := make(chan *Command, len(test.items))
+		inputCh := make(chan inputStats, len(test.items)+1)
+
+		parseInput(ch, inputCh, "echo", []string{"{}"})
+
+		_ = f.Close()
+
+		var items []string
+		for c := range ch {
+			items = append(items, c.Tag)
+		}
+
+		if !reflect.DeepEqual(test.items, items) {
+			t.Errorf("test %d failed: want %q, got %q", i, test.items, items)
+		}
+	}
+}
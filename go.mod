@@ -6,5 +6,5 @@ require (
 	github.com/fatih/color v1.10.0
 	github.com/fd0/termstatus v1.1.0
 	github.com/spf13/pflag v1.0.5
-	golang.org/x/sys v0.0.0-20201231184435-2d18734c6014 // indirect
+	golang.org/x/sys v0.0.0-20201231184435-2d18734c6014
 )
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultStatusFormat is the template for the first status line, it produces
+// the same line as earlier versions (plus the margin of the ETA). The other
+// fields are only shown with --status-format.
+const defaultStatusFormat = `[{{.Elapsed}}] {{.Processed}}/{{.Total}}` +
+	`{{if .TotalFinal}} processed ({{.Failed}} failed) ETA {{.ETA}}{{with .ETAMargin}} (±{{.}}){{end}},` +
+	`{{else}}+ processed ({{.Failed}} failed),{{end}} {{.Running}}/{{.Workers}} workers:`
+
+// detailedStatusFormat is the template for the first status line selected with
+// --status-format detailed, it adds a progress bar, the throughput and the
+// percentage of successful and failed items.
+const detailedStatusFormat = `[{{.Elapsed}}] {{with .Bar}}{{.}} {{end}}{{.Processed}}/{{.Total}}{{if not .TotalFinal}}+{{end}} ` +
+	`({{.Failed}} failed: {{printf "%.0f" .SuccessPercent}}% ok, {{printf "%.0f" .FailPercent}}% failed) ` +
+	`{{printf "%.1f" .Rate}}/s avg {{printf "%.1f" .AvgRate}}/s ` +
+	`ETA {{.ETA}}{{with .ETAMargin}} (±{{.}}){{end}} {{.Running}}/{{.Workers}} workers:`
+
+// statusPresets contains templates for --status-format which can be selected
+// by name.
+var statusPresets = map[string]string{
+	"default":  defaultStatusFormat,
+	"detailed": detailedStatusFormat,
+}
+
+// statusFormat renders the first status line, it is set by --status-format.
+var statusFormat = template.Must(parseStatusFormat(defaultStatusFormat))
+
+// parseStatusFormat parses the name of a preset or a template for the first
+// status line and checks that it can be executed.
+func parseStatusFormat(s string) (*template.Template, error) {
+	if preset, ok := statusPresets[s]; ok {
+		s = preset
+	}
+
+	tmpl, err := template.New("status").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --status-format: %w", err)
+	}
+
+	err = tmpl.Execute(&strings.Builder{}, statusFields{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid --status-format: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// statusFields contains the values available in the template for the first
+// status line.
+type statusFields struct {
+	Elapsed string
+	ETA     string
+
+	// ETAMargin is the margin of error of the ETA, it is empty if unknown
+	ETAMargin string
+
+	// Total is the number of items read so far, TotalFinal is set when all
+	// input has been read.
+	Total      int
+	TotalFinal bool
+
+	Processed      int
+	Succeeded      int
+	Failed         int
+	SuccessPercent float64
+	FailPercent    float64
+
+	// Rate is the number of items processed per second during the last few
+	// seconds, AvgRate the average since the start.
+	Rate    float64
+	AvgRate float64
+
+	Running int
+	Workers int
+
+	// Bar is a progress bar which takes up the remaining width of the
+	// terminal, it is empty as long as the total is not known.
+	Bar string
+}
+
+const (
+	// minStatusBarWidth is the minimal width of the overall progress bar, it
+	// is omitted if less space is available.
+	minStatusBarWidth = 10
+
+	// maxStatusBarWidth is the maximal width of the overall progress bar.
+	maxStatusBarWidth = 40
+
+	// defaultTerminalWidth is used when the width of the terminal is unknown.
+	defaultTerminalWidth = 80
+)
+
+// renderStatus executes the status template. If fraction is not negative, a
+// progress bar is added so that the line (plus a separating space) fits into
+// width bytes.
+func renderStatus(tmpl *template.Template, fields statusFields, fraction float64, width int) (string, error) {
+	var buf strings.Builder
+
+	err := tmpl.Execute(&buf, fields)
+	if err != nil {
+		return "", err
+	}
+
+	if fraction < 0 {
+		return buf.String(), nil
+	}
+
+	barWidth := width - len(buf.String()) - 1
+	if barWidth > maxStatusBarWidth {
+		barWidth = maxStatusBarWidth
+	}
+
+	if barWidth < minStatusBarWidth {
+		return buf.String(), nil
+	}
+
+	fields.Bar = renderBar(fraction, barWidth-2) //nolint:gomnd
+
+	buf.Reset()
+
+	err = tmpl.Execute(&buf, fields)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// throughputWindow is the period over which the current throughput is
+// measured.
+const throughputWindow = 5 * time.Second
+
+// throughput measures the number of items processed per second.
+type throughput struct {
+	samples []throughputSample
+}
+
+type throughputSample struct {
+	t         time.Time
+	processed int
+}
+
+// Add records the number of items processed at time t.
+func (tp *throughput) Add(t time.Time, processed int) {
+	tp.samples = append(tp.samples, throughputSample{t: t, processed: processed})
+
+	// keep one sample older than the window as the starting point
+	for len(tp.samples) > 2 && t.Sub(tp.samples[1].t) > throughputWindow {
+		tp.samples = tp.samples[1:]
+	}
+}
+
+// Rate returns the number of items processed per second within the window.
+func (tp *throughput) Rate() float64 {
+	if len(tp.samples) < 2 { //nolint:gomnd
+		return 0
+	}
+
+	first, last := tp.samples[0], tp.samples[len(tp.samples)-1]
+
+	d := last.t.Sub(first.t)
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(last.processed-first.processed) / d.Seconds()
+}
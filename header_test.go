@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderStatus(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := parseStatusFormat("{{.Processed}}/{{.Total}}{{with .Bar}} {{.}}{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		fraction float64
+		width    int
+		status   string
+	}{
+		{-1, 80, "3/6"},
+		{0.5, 16, "3/6 [#####     ]"},
+		{1, 16, "3/6 [##########]"},
+		{0.5, 10, "3/6"},
+		{0.5, 1000, "3/6 [" + strings.Repeat("#", 19) + strings.Repeat(" ", 19) + "]"},
+	}
+
+	for i, test := range tests {
+		status, err := renderStatus(tmpl, statusFields{Processed: 3, Total: 6}, test.fraction, test.width)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+			continue
+		}
+
+		if status != test.status {
+			t.Errorf("test %d failed: want %q, got %q", i, test.status, status)
+		}
+	}
+}
+
+func TestDefaultStatusFormat(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		fields statusFields
+		status string
+	}{
+		{
+			statusFields{Elapsed: "0:05", Processed: 3, Total: 10, Failed: 1, Running: 4, Workers: 4},
+			"[0:05] 3/10+ processed (1 failed), 4/4 workers:",
+		},
+		{
+			statusFields{Elapsed: "0:05", ETA: "---", Processed: 3, Total: 10, TotalFinal: true, Running: 4, Workers: 4},
+			"[0:05] 3/10 processed (0 failed) ETA ---, 4/4 workers:",
+		},
+		{
+			statusFields{Elapsed: "1:00", ETA: "2:00", ETAMargin: "0:15", Processed: 5, Total: 10, TotalFinal: true,
+				Failed: 2, Running: 2, Workers: 4},
+			"[1:00] 5/10 processed (2 failed) ETA 2:00 (±0:15), 2/4 workers:",
+		},
+	}
+
+	for i, test := range tests {
+		// the progress bar is not part of the default line
+		status, err := renderStatus(statusFormat, test.fields, 0.5, 200)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+			continue
+		}
+
+		if status != test.status {
+			t.Errorf("test %d failed: want %q, got %q", i, test.status, status)
+		}
+	}
+}
+
+func TestDetailedStatusFormat(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := parseStatusFormat("detailed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		fields   statusFields
+		fraction float64
+		status   string
+	}{
+		{
+			statusFields{Elapsed: "0:05", ETA: "---", Processed: 3, Total: 10, Failed: 1, SuccessPercent: 66.7,
+				FailPercent: 33.3, Rate: 0.6, AvgRate: 0.6, Running: 4, Workers: 4},
+			-1,
+			"[0:05] 3/10+ (1 failed: 67% ok, 33% failed) 0.6/s avg 0.6/s ETA --- 4/4 workers:",
+		},
+		{
+			statusFields{Elapsed: "1:00", ETA: "2:00", ETAMargin: "0:15", Processed: 5, Total: 10, TotalFinal: true,
+				SuccessPercent: 100, Rate: 1.5, AvgRate: 0.8, Running: 2, Workers: 4},
+			0.5,
+			"[1:00] [#####     ] 5/10 (0 failed: 100% ok, 0% failed) 1.5/s avg 0.8/s ETA 2:00 (±0:15) 2/4 workers:",
+		},
+	}
+
+	for i, test := range tests {
+		status, err := renderStatus(tmpl, test.fields, test.fraction, 102)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+			continue
+		}
+
+		if status != test.status {
+			t.Errorf("test %d failed: want %q, got %q", i, test.status, status)
+		}
+	}
+}
+
+func TestParseStatusFormatInvalid(t *testing.T) {
+	t.Parallel()
+
+	for i, format := range []string{"{{.Processed", "{{.Unknown}}"} {
+		_, err := parseStatusFormat(format)
+		if err == nil {
+			t.Errorf("test %d failed: expected error for %q", i, format)
+		}
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	t.Parallel()
+
+	var tp throughput
+
+	start := time.Now()
+
+	if tp.Rate() != 0 {
+		t.Errorf("want rate 0 without samples, got %v", tp.Rate())
+	}
+
+	// 10 items per second for 10 seconds, then 2 items per second
+	for i := 0; i <= 10; i++ {
+		tp.Add(start.Add(time.Duration(i)*time.Second), 10*i)
+	}
+
+	if rate := tp.Rate(); rate != 10 {
+		t.Errorf("want rate 10, got %v", rate)
+	}
+
+	for i := 1; i <= 10; i++ {
+		tp.Add(start.Add(time.Duration(10+i)*time.Second), 100+2*i)
+	}
+
+	if rate := tp.Rate(); rate != 2 {
+		t.Errorf("want rate 2, got %v", rate)
+	}
+}
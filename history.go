@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// historyMaxAge is the time after which items which have not been processed
+// again are removed from the history.
+const historyMaxAge = 90 * 24 * time.Hour
+
+// historyEntry is the duration of the last successful job for an item.
+type historyEntry struct {
+	Duration float64   `json:"duration"`
+	Weight   float64   `json:"weight"`
+	Time     time.Time `json:"time"`
+}
+
+// historyFile is the content of a history file.
+type historyFile struct {
+	Command []string                 `json:"command"`
+	Dir     string                   `json:"dir"`
+	Items   map[string]*historyEntry `json:"items"`
+}
+
+// history contains the durations of the jobs of previous runs of the same
+// command. It is stored in a JSON file in the state directory, named after a
+// fingerprint of the command, the working directory and --weight-by.
+type history struct {
+	m sync.Mutex
+
+	filename string
+	data     historyFile
+
+	// updated contains the items processed in this run
+	updated map[string]*historyEntry
+}
+
+// historyFingerprint returns a string identifying the command.
+func historyFingerprint(dir, weightBy string, command []string) string {
+	hash := sha256.New()
+
+	for _, s := range append([]string{dir, weightBy}, command...) {
+		// include the terminating null byte so that the strings cannot be
+		// shifted between fields
+		_, _ = hash.Write([]byte(s + "\x00"))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// loadHistory returns the history for the command, which is empty if the
+// command has not been run before.
+func loadHistory(command []string) (*history, error) {
+	state, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &history{
+		filename: filepath.Join(state, "history", historyFingerprint(dir, opts.weightBy, command)+".json"),
+		data: historyFile{
+			Command: command,
+			Dir:     dir,
+		},
+		updated: make(map[string]*historyEntry),
+	}
+
+	h.data.Items, err = readHistoryItems(h.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// readHistoryItems returns the items stored in a history file. A missing file
+// is not an error.
+func readHistoryItems(filename string) (map[string]*historyEntry, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return make(map[string]*historyEntry), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var data historyFile
+
+	err = json.Unmarshal(buf, &data)
+	if err != nil {
+		return nil, fmt.Errorf("history %v: %w", filename, err)
+	}
+
+	if data.Items == nil {
+		data.Items = make(map[string]*historyEntry)
+	}
+
+	return data.Items, nil
+}
+
+// Duration returns the duration of the last successful job for the item.
+func (h *history) Duration(item string) (time.Duration, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	e, ok := h.data.Items[item]
+	if !ok {
+		return 0, false
+	}
+
+	return seconds(e.Duration), true
+}
+
+// historyMaxSamples is the number of samples the history counts as at most in
+// PerUnit, so that the jobs finished in this run soon outweigh it.
+const historyMaxSamples = 10
+
+// PerUnit returns the durations in seconds per unit of weight of all items in
+// the history. The mean and the standard deviation are those of all items,
+// but they count as at most historyMaxSamples samples.
+func (h *history) PerUnit() moments {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	var m moments
+
+	for _, e := range h.data.Items {
+		if e.Weight > 0 {
+			m.Add(e.Duration / e.Weight)
+		}
+	}
+
+	if m.n > historyMaxSamples {
+		f := float64(historyMaxSamples) / float64(m.n)
+		m = moments{n: historyMaxSamples, sum: m.sum * f, sumSq: m.sumSq * f}
+	}
+
+	return m
+}
+
+// Add records the duration of a successful job.
+func (h *history) Add(item string, d time.Duration, weight float64) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	e := &historyEntry{
+		Duration: d.Seconds(),
+		Weight:   weight,
+		Time:     time.Now(),
+	}
+
+	h.data.Items[item] = e
+	h.updated[item] = e
+}
+
+// Save writes the history to the file. Items processed by other runs in the
+// meantime are kept, items which have not been processed for a long time are
+// removed.
+func (h *history) Save() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	items, err := readHistoryItems(h.filename)
+	if err != nil {
+		return err
+	}
+
+	for item, e := range h.updated {
+		items[item] = e
+	}
+
+	for item, e := range items {
+		if time.Since(e.Time) > historyMaxAge {
+			delete(items, item)
+		}
+	}
+
+	data := h.data
+	data.Items = items
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(h.filename), 0700)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that a concurrent run never reads
+	// a partially written file
+	f, err := ioutil.TempFile(filepath.Dir(h.filename), filepath.Base(h.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		_ = os.Remove(f.Name())
+
+		return err
+	}
+
+	return os.Rename(f.Name(), h.filename)
+}
+
+// jobHistory is set when --history is used.
+var jobHistory *history
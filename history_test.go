@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHistoryFingerprint(t *testing.T) {
+	t.Parallel()
+
+	fp := historyFingerprint("/tmp", "", []string{"echo", "{}"})
+
+	var tests = []struct {
+		dir      string
+		weightBy string
+		command  []string
+	}{
+		{"/", "", []string{"echo", "{}"}},
+		{"/tmp", "size", []string{"echo", "{}"}},
+		{"/tmp", "", []string{"echo", "-n", "{}"}},
+		{"/tmp", "", []string{"echo {}"}},
+	}
+
+	for i, test := range tests {
+		if historyFingerprint(test.dir, test.weightBy, test.command) == fp {
+			t.Errorf("test %d failed: fingerprint is the same as for a different command", i)
+		}
+	}
+
+	if historyFingerprint("/tmp", "", []string{"echo", "{}"}) != fp {
+		t.Errorf("fingerprint is not stable")
+	}
+}
+
+func TestHistorySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	oldStateHome := os.Getenv("XDG_STATE_HOME")
+	defer os.Setenv("XDG_STATE_HOME", oldStateHome)
+
+	err = os.Setenv("XDG_STATE_HOME", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command := []string{"sleep", "{}"}
+
+	h, err := loadHistory(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := h.Duration("1"); ok {
+		t.Errorf("empty history returned a duration")
+	}
+
+	// two runs of the same command in parallel
+	h2, err := loadHistory(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Add("1", time.Second, 1)
+	h.Add("2", 4*time.Second, 2)
+	h2.Add("3", 3*time.Second, 1)
+
+	for _, h := range []*history{h, h2} {
+		err = h.Save()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err = loadHistory(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for item, want := range map[string]time.Duration{"1": time.Second, "2": 4 * time.Second, "3": 3 * time.Second} {
+		d, ok := h.Duration(item)
+		if !ok || d != want {
+			t.Errorf("item %v: want duration %v, got %v", item, want, d)
+		}
+	}
+
+	if m := h.PerUnit(); m.n != 3 || m.Mean() != 2 {
+		t.Errorf("want 3 durations with mean 2, got %v with mean %v", m.n, m.Mean())
+	}
+}
+
+func TestHistoryPerUnitCapped(t *testing.T) {
+	t.Parallel()
+
+	h := &history{data: historyFile{Items: make(map[string]*historyEntry)}}
+
+	for i := 0; i < 40; i++ {
+		// durations per unit alternate between 1 and 3
+		h.data.Items[fmt.Sprintf("item-%d", i)] = &historyEntry{Duration: float64(2 + 4*(i%2)), Weight: 2}
+	}
+
+	m := h.PerUnit()
+	if m.n != historyMaxSamples {
+		t.Errorf("want %d samples, got %d", historyMaxSamples, m.n)
+	}
+
+	if m.Mean() != 2 {
+		t.Errorf("want mean 2, got %v", m.Mean())
+	}
+
+	// ten durations from this run count as much as the whole history
+	for i := 0; i < historyMaxSamples; i++ {
+		m.Add(4)
+	}
+
+	if m.Mean() != 3 {
+		t.Errorf("want mean 3 after adding new durations, got %v", m.Mean())
+	}
+}
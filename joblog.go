@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// jobLogEntry is written to the job log for each finished job, as one JSON
+// object per line.
+type jobLogEntry struct {
+	ID       int       `json:"id"`
+	Item     string    `json:"item"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+
+	ExitCode    int    `json:"exit_code"`
+	Signal      string `json:"signal,omitempty"`
+	StartFailed bool   `json:"start_failed,omitempty"`
+	TimedOut    bool   `json:"timed_out,omitempty"`
+	OOMKilled   bool   `json:"oom_killed,omitempty"`
+
+	UserTime   float64 `json:"user_time,omitempty"`
+	SystemTime float64 `json:"system_time,omitempty"`
+	MaxRSS     int64   `json:"max_rss,omitempty"`
+	InBlock    int64   `json:"in_block,omitempty"`
+	OutBlock   int64   `json:"out_block,omitempty"`
+}
+
+// jobLog records information about all finished jobs in a file.
+type jobLog struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func createJobLog(filename string) (*jobLog, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jobLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write adds the final status of a job to the log.
+func (l *jobLog) Write(s Status) error {
+	entry := jobLogEntry{
+		ID:   s.ID,
+		Item: s.Tag,
+	}
+
+	if s.Error {
+		entry.Error = s.Message
+	}
+
+	if res := s.Result; res != nil {
+		entry.Start = res.Start
+		entry.Duration = res.Duration.Seconds()
+		entry.ExitCode = res.ExitCode
+		entry.Signal = res.Signal
+		entry.StartFailed = res.StartFailed
+		entry.TimedOut = res.TimedOut
+		entry.OOMKilled = res.OOMKilled
+
+		if u := res.Usage; u != nil {
+			entry.UserTime = u.UserTime.Seconds()
+			entry.SystemTime = u.SystemTime.Seconds()
+			entry.MaxRSS = u.MaxRSS
+			entry.InBlock = u.InBlock
+			entry.OutBlock = u.OutBlock
+		}
+	}
+
+	return l.enc.Encode(entry)
+}
+
+func (l *jobLog) Close() error {
+	return l.f.Close()
+}
+
+// joblog is written to if set.
+var joblog *jobLog
+
+// readJobLogDurations returns the durations of all successful jobs recorded in
+// a job log.
+func readJobLogDurations(filename string) ([]time.Duration, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var durations []time.Duration
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var entry jobLogEntry
+
+		err = json.Unmarshal(sc.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %w", filename, line, err)
+		}
+
+		// skip jobs which failed or were killed, e.g. by an earlier timeout
+		failed := entry.Error != "" || entry.Signal != "" || entry.TimedOut || entry.OOMKilled || entry.StartFailed
+		if failed || entry.Duration <= 0 {
+			continue
+		}
+
+		durations = append(durations, time.Duration(entry.Duration*float64(time.Second)))
+	}
+
+	return durations, sc.Err()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobLogWrite(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 5, 17, 10, 0, 0, 0, time.UTC)
+	usage := &Usage{UserTime: 1500 * time.Millisecond, SystemTime: 500 * time.Millisecond, MaxRSS: 4096}
+
+	var tests = []struct {
+		status Status
+		fields map[string]interface{}
+	}{
+		// exited successfully
+		{
+			Status{ID: 1, Tag: "a", Done: true, Result: &Result{Start: start, Duration: 2 * time.Second, Usage: usage}},
+			map[string]interface{}{
+				"id": 1.0, "item": "a", "start": "2020-05-17T10:00:00Z", "duration": 2.0, "exit_code": 0.0,
+				"user_time": 1.5, "system_time": 0.5, "max_rss": 4096.0,
+			},
+		},
+		// exited with an error code
+		{
+			Status{ID: 2, Tag: "b", Done: true, Error: true, Message: "exit status 3",
+				Result: &Result{Start: start, Duration: time.Second, Usage: &Usage{}, ExitCode: 3}},
+			map[string]interface{}{
+				"id": 2.0, "item": "b", "start": "2020-05-17T10:00:00Z", "duration": 1.0,
+				"error": "exit status 3", "exit_code": 3.0,
+			},
+		},
+		// terminated by a signal
+		{
+			Status{ID: 3, Tag: "c", Done: true, Error: true, Message: "signal: terminated",
+				Result: &Result{Start: start, Duration: time.Second, Usage: &Usage{}, ExitCode: -1, Signal: "terminated"}},
+			map[string]interface{}{
+				"id": 3.0, "item": "c", "start": "2020-05-17T10:00:00Z", "duration": 1.0,
+				"error": "signal: terminated", "exit_code": -1.0, "signal": "terminated",
+			},
+		},
+		// killed after a timeout
+		{
+			Status{ID: 4, Tag: "d", Done: true, Error: true, Message: "signal: killed",
+				Result: &Result{Start: start, Duration: time.Second, Usage: &Usage{}, ExitCode: -1, Signal: "killed", TimedOut: true}},
+			map[string]interface{}{
+				"id": 4.0, "item": "d", "start": "2020-05-17T10:00:00Z", "duration": 1.0,
+				"error": "signal: killed", "exit_code": -1.0, "signal": "killed", "timed_out": true,
+			},
+		},
+		// killed because of the memory limit
+		{
+			Status{ID: 5, Tag: "e", Done: true, Error: true, Message: "signal: killed",
+				Result: &Result{Start: start, Duration: time.Second, Usage: &Usage{}, ExitCode: -1, Signal: "killed", OOMKilled: true}},
+			map[string]interface{}{
+				"id": 5.0, "item": "e", "start": "2020-05-17T10:00:00Z", "duration": 1.0,
+				"error": "signal: killed", "exit_code": -1.0, "signal": "killed", "oom_killed": true,
+			},
+		},
+		// not started
+		{
+			Status{ID: 6, Tag: "f", Done: true, Error: true, Message: "executable file not found",
+				Result: &Result{Start: start, ExitCode: -1, StartFailed: true}},
+			map[string]interface{}{
+				"id": 6.0, "item": "f", "start": "2020-05-17T10:00:00Z", "duration": 0.0,
+				"error": "executable file not found", "exit_code": -1.0, "start_failed": true,
+			},
+		},
+	}
+
+	filename := filepath.Join(dir, "joblog")
+
+	log, err := createJobLog(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		err = log.Write(test.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = log.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+
+	for i, test := range tests {
+		if !sc.Scan() {
+			t.Fatalf("test %d failed: line missing in job log, error %v", i, sc.Err())
+		}
+
+		var fields map[string]interface{}
+
+		err = json.Unmarshal(sc.Bytes(), &fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(test.fields, fields) {
+			t.Errorf("test %d failed: want %v, got %v", i, test.fields, fields)
+		}
+	}
+
+	if sc.Scan() {
+		t.Errorf("unexpected line in job log: %q", sc.Text())
+	}
+}
+
+func TestReadJobLogDurations(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	lines := []string{
+		`{"id":1,"item":"a","duration":2,"exit_code":0}`,
+		`{"id":2,"item":"b","duration":3,"exit_code":1,"error":"exit status 1"}`,
+		`{"id":3,"item":"c","duration":60,"exit_code":-1,"signal":"killed","timed_out":true}`,
+		`{"id":4,"item":"d","duration":5,"exit_code":-1,"signal":"killed","oom_killed":true}`,
+		`{"id":5,"item":"e","duration":0,"exit_code":-1,"start_failed":true}`,
+		`{"id":6,"item":"f","duration":4,"exit_code":-1,"signal":"terminated"}`,
+		`{"id":7,"item":"g","duration":1.5,"exit_code":3}`,
+	}
+
+	filename := filepath.Join(dir, "joblog")
+
+	err = ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	durations, err := readJobLogDurations(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Duration{2 * time.Second, 1500 * time.Millisecond}
+	if !reflect.DeepEqual(want, durations) {
+		t.Errorf("want %v, got %v", want, durations)
+	}
+}
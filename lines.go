@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ScanLinesAndProgress splits output into lines like bufio.ScanLines, but also
+// treats a carriage return which is not followed by a line feed as the end of
+// a token. Programs use a lone carriage return to overwrite the current line
+// with a progress message. The terminator is included in the token, so the
+// caller can distinguish lines ("\n" or "\r\n") from progress messages ("\r").
+func ScanLinesAndProgress(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	i := bytes.IndexAny(data, "\r\n")
+	if i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i+1], nil
+		}
+
+		// a carriage return at the end of the data may be followed by a line feed
+		// in the next read, don't wait for it so that progress is shown
+		// immediately, the caller handles an empty line following a progress
+		// message
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i+2], nil
+		}
+
+		return i + 1, data[:i+1], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// isProgress returns true if the token returned by ScanLinesAndProgress is a
+// progress message.
+func isProgress(token []byte) bool {
+	return len(token) > 0 && token[len(token)-1] == '\r'
+}
+
+// trimLineEnd removes the terminator from a token returned by
+// ScanLinesAndProgress.
+func trimLineEnd(token []byte) []byte {
+	return bytes.TrimRight(token, "\r\n")
+}
+
+// maxLineLength is the maximum length of a line, longer lines are truncated.
+// It must be smaller than bufio.MaxScanTokenSize.
+const maxLineLength = 16 * 1024
+
+// truncatedMarker is appended to truncated lines.
+const truncatedMarker = " [truncated]"
+
+// lineSplitter splits output like ScanLinesAndProgress, but truncates lines
+// longer than maxLineLength instead of failing.
+type lineSplitter struct {
+	// discard is set while the rest of a truncated line is skipped
+	discard bool
+}
+
+// truncate returns the first maxLineLength bytes of token with a marker, the
+// terminator is preserved.
+func truncate(token []byte, terminator []byte) []byte {
+	t := make([]byte, 0, maxLineLength+len(truncatedMarker)+len(terminator))
+	t = append(t, token[:maxLineLength]...)
+	t = append(t, truncatedMarker...)
+	t = append(t, terminator...)
+
+	return t
+}
+
+// Split is a bufio.SplitFunc.
+func (s *lineSplitter) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if s.discard {
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			return len(data), nil, nil
+		}
+
+		s.discard = false
+
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, nil, nil
+		}
+
+		return i + 1, nil, nil
+	}
+
+	advance, token, err = ScanLinesAndProgress(data, atEOF)
+	if err != nil {
+		return advance, token, err
+	}
+
+	if token == nil {
+		if len(data) <= maxLineLength {
+			return advance, token, err
+		}
+
+		// no line ending found within the maximum length, skip the rest of the line
+		s.discard = true
+
+		return maxLineLength, truncate(data, []byte("\n")), nil
+	}
+
+	line := trimLineEnd(token)
+	if len(line) > maxLineLength {
+		return advance, truncate(line, token[len(line):]), nil
+	}
+
+	return advance, token, nil
+}
+
+// escapeSequence matches ANSI escape sequences: CSI sequences like colors or
+// cursor movements, OSC sequences like window titles, and two-byte sequences.
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// colorSequence matches the escape sequences for colors and text attributes.
+var colorSequence = regexp.MustCompile(`^\x1b\[[0-9;]*m$`)
+
+// removeControl removes all control characters except tabs.
+func removeControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+// sanitize replaces invalid UTF-8 in a line printed by a program and removes
+// all control characters except tabs, so that it cannot mess up the terminal.
+// Escape sequences for colors are kept if keepColors is set, all other escape
+// sequences are removed.
+func sanitize(line string, keepColors bool) string {
+	line = strings.ToValidUTF8(line, "\uFFFD")
+
+	var b strings.Builder
+
+	last := 0
+
+	for _, m := range escapeSequence.FindAllStringIndex(line, -1) {
+		b.WriteString(removeControl(line[last:m[0]]))
+
+		if seq := line[m[0]:m[1]]; keepColors && colorSequence.MatchString(seq) {
+			b.WriteString(seq)
+		}
+
+		last = m[1]
+	}
+
+	b.WriteString(removeControl(line[last:]))
+
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var progressTests = []struct {
+	input  string
+	output []string
+}{
+	{
+		"foo\nbar\r\nbaz",
+		[]string{"foo\n", "bar\r\n", "baz"},
+	},
+	{
+		" 10%\r 20%\r100%\n",
+		[]string{" 10%\r", " 20%\r", "100%\n"},
+	},
+	{
+		"\r 10%\r 20%\r\n",
+		[]string{"\r", " 10%\r", " 20%\r\n"},
+	},
+	{
+		"foo\r",
+		[]string{"foo\r"},
+	},
+}
+
+func TestScanLinesAndProgress(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range progressTests {
+		sc := bufio.NewScanner(strings.NewReader(test.input))
+		sc.Split(ScanLinesAndProgress)
+
+		var output []string
+		for sc.Scan() {
+			output = append(output, sc.Text())
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("test %d failed: want %q, got %q", i, test.output, output)
+		}
+	}
+}
+
+func TestLineSplitter(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", maxLineLength)
+
+	var tests = []struct {
+		input  string
+		output []string
+	}{
+		{
+			"foo\nbar\r",
+			[]string{"foo\n", "bar\r"},
+		},
+		{
+			long + "\n",
+			[]string{long + "\n"},
+		},
+		{
+			long + "yyy\nfoo\n",
+			[]string{long + truncatedMarker + "\n", "foo\n"},
+		},
+		{
+			long + long + long + "\r\nfoo\n",
+			[]string{long + truncatedMarker + "\n", "foo\n"},
+		},
+		{
+			long + long,
+			[]string{long + truncatedMarker + "\n"},
+		},
+	}
+
+	for i, test := range tests {
+		var splitter lineSplitter
+
+		sc := bufio.NewScanner(strings.NewReader(test.input))
+		sc.Split(splitter.Split)
+
+		var output []string
+		for sc.Scan() {
+			output = append(output, sc.Text())
+		}
+
+		if sc.Err() != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, sc.Err())
+			continue
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("test %d failed: want %d lines, got %d lines", i, len(test.output), len(output))
+		}
+	}
+}
+
+var sanitizeTests = []struct {
+	input      string
+	keepColors bool
+	output     string
+}{
+	{"foo\tbar", true, "foo\tbar"},
+	{"foo\x00\x07bar", true, "foobar"},
+	{"foo\xffbar", true, "foo�bar"},
+	{"\x1b[31mred\x1b[0m", true, "\x1b[31mred\x1b[0m"},
+	{"\x1b[31mred\x1b[0m", false, "red"},
+	{"\x1b[2Kfoo\x1b[1A", true, "foo"},
+	{"\x1b]0;title\x07foo", true, "foo"},
+}
+
+func TestSanitize(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range sanitizeTests {
+		output := sanitize(test.input, test.keepColors)
+		if output != test.output {
+			t.Errorf("test %d failed: want %q, got %q", i, test.output, output)
+		}
+	}
+}
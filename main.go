@@ -3,11 +3,14 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,8 +28,86 @@ var opts = struct {
 	hideJobID        bool
 	hideTimestamp    bool
 	hideName         bool
+	rate             string
+	delay            time.Duration
+	adaptive         bool
+	limitBy          string
+	limit            int
+	semaphore        string
+	semaphoreSlots   int
+	showUsage        bool
+	joblog           string
+	memLimit         string
+	cpuQuota         string
+	pidsLimit        int
+	cgroupParent     string
+	nice             int
+	ioniceClass      string
+	pinCPUs          bool
+	idleTimeout      time.Duration
+	deadline         time.Duration
+	until            string
+	timeoutFrom      string
+	timeoutPatterns  []string
+	timeoutFactor    float64
+	timeoutMin       time.Duration
+	timeoutHistory   string
+	successCodes     []int
+	failOnOutput     string
+	failOnStderr     bool
+	failedOut        string
+	pty              bool
+	progressRegex    string
+	statusFormat     string
+	eta              string
+	weightBy         string
+	history          bool
+	order            string
+	shuffle          bool
+	seed             int64
+	sort             bool
+	unique           bool
+	fields           bool
+	drainTimeout     time.Duration
 }{}
 
+// fieldPlaceholder matches placeholders for single fields of an item, e.g. {1}.
+var fieldPlaceholder = regexp.MustCompile(`\{([1-9][0-9]*)\}`)
+
+// expandTemplate replaces the placeholder in tmpl with the item and all field
+// placeholders like {2} with the whitespace-separated field of the item.
+func expandTemplate(tmpl, item string, fields []string) string {
+	var b strings.Builder
+
+	last := 0
+
+	for _, m := range fieldPlaceholder.FindAllStringSubmatchIndex(tmpl, -1) {
+		b.WriteString(strings.ReplaceAll(tmpl[last:m[0]], opts.placeholder, item))
+
+		n, _ := strconv.Atoi(tmpl[m[2]:m[3]])
+		if n <= len(fields) {
+			b.WriteString(fields[n-1])
+		}
+
+		last = m[1]
+	}
+
+	b.WriteString(strings.ReplaceAll(tmpl[last:], opts.placeholder, item))
+
+	return b.String()
+}
+
+// expandCommand replaces the placeholders in the name or an argument of the
+// command. Field placeholders are only replaced with --fields, so that literal
+// braces like in regular expressions are passed on unchanged.
+func expandCommand(arg, item string, fields []string) string {
+	if !opts.fields {
+		return strings.ReplaceAll(arg, opts.placeholder, item)
+	}
+
+	return expandTemplate(arg, item, fields)
+}
+
 // ScanNullSeparatedValues splits data by null bytes.
 func ScanNullSeparatedValues(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
@@ -46,7 +127,16 @@ func ScanNullSeparatedValues(data []byte, atEOF bool) (advance int, token []byte
 	return 0, nil, nil
 }
 
-func parseInput(ch chan<- *Command, jobNumCh chan<- int, cmd string, args []string) {
+// inputStats describes the items read so far.
+type inputStats struct {
+	jobs   int
+	weight float64
+
+	// duplicates is the number of items skipped by --unique
+	duplicates int
+}
+
+func parseInput(ch chan<- *Command, inputCh chan<- inputStats, cmd string, args []string) {
 	defer close(ch)
 
 	sc := bufio.NewScanner(os.Stdin)
@@ -56,11 +146,14 @@ func parseInput(ch chan<- *Command, jobNumCh chan<- int, cmd string, args []stri
 	}
 
 	jobnum := 0
+	totalWeight := 0.0
 
-	defer func() {
-		jobNumCh <- jobnum
-		close(jobNumCh)
-	}()
+	// buffered collects all commands if the input needs to be reordered
+	var buffered []*Command
+
+	// seen contains all items for --unique
+	seen := make(map[string]bool)
+	duplicates := 0
 
 	for sc.Scan() {
 		jobnum++
@@ -76,38 +169,83 @@ func parseInput(ch chan<- *Command, jobNumCh chan<- int, cmd string, args []stri
 			continue
 		}
 
-		cmdName = strings.ReplaceAll(cmdName, opts.placeholder, line)
+		if opts.unique {
+			if seen[line] {
+				duplicates++
+
+				continue
+			}
+
+			seen[line] = true
+		}
+
+		fields := strings.Fields(line)
+
+		cmdName = expandCommand(cmdName, line, fields)
 
 		for _, arg := range args {
-			cmdArgs = append(cmdArgs, strings.ReplaceAll(arg, opts.placeholder, line))
+			cmdArgs = append(cmdArgs, expandCommand(arg, line, fields))
 		}
 
-		ch <- &Command{
+		c := &Command{
 			ID:   jobnum,
 			Tag:  line,
 			Cmd:  cmdName,
 			Args: cmdArgs,
 		}
 
+		if opts.limitBy != "" {
+			c.Key = expandTemplate(opts.limitBy, line, fields)
+		}
+
+		timeout, err := itemTimeout(line, fields)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "item %v: %v, using the default timeout\n", line, err)
+		}
+
+		c.Timeout = timeout
+
+		weight, err := itemWeight(line, fields)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "item %v: %v, using the weight 0\n", line, err)
+		}
+
+		c.Weight = weight
+		totalWeight += weight
+
+		if orderedInput() {
+			buffered = append(buffered, c)
+		} else {
+			ch <- c
+		}
+
 		if jobnum%10 == 0 {
-			jobNumCh <- jobnum
+			inputCh <- inputStats{jobs: jobnum - duplicates, weight: totalWeight, duplicates: duplicates}
 		}
 	}
+
+	inputCh <- inputStats{jobs: jobnum - duplicates, weight: totalWeight, duplicates: duplicates}
+	close(inputCh)
+
+	sortCommands(buffered)
+
+	for _, c := range buffered {
+		ch <- c
+	}
 }
 
-func checkForPlaceholder(cmdname string, args []string) {
-	if cmdname == opts.placeholder {
-		return
+func checkForPlaceholder(cmdname string, args []string) error {
+	if cmdname == opts.placeholder || (opts.fields && fieldPlaceholder.MatchString(cmdname)) {
+		return nil
 	}
 
 	for _, arg := range args {
-		if strings.Contains(arg, opts.placeholder) {
-			return
+		if strings.Contains(arg, opts.placeholder) || (opts.fields && fieldPlaceholder.MatchString(arg)) {
+			return nil
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "no placeholder found\n")
-	os.Exit(2) //nolint:gomnd
+	return errors.New("no placeholder found")
 }
 
 // Status is one message printed by a command.
@@ -119,6 +257,21 @@ type Status struct {
 
 	Done  bool
 	Start bool
+
+	// Result is set for the final status of a job
+	Result *Result
+
+	// Skipped is set for the final status of a job which was not started
+	Skipped bool
+
+	// Progress is set for messages which only update the status line of the
+	// job and are not logged
+	Progress bool
+
+	// Weight is the weight of the item and Slot the worker running the job,
+	// they are set for the start status
+	Weight float64
+	Slot   int
 }
 
 //nolint:gomnd
@@ -150,63 +303,140 @@ var (
 	lastLineCount          = 0
 	lastLineCountReduction time.Time
 	smoothLines            = 0
-	etaEWMA                *ewma
+	etaEstimator           estimator
 	lastETA                time.Duration
+	lastETAMargin          time.Duration
 	lastETAUpdate          time.Time
+	itemRate               throughput
 )
 
-func updateTerminal(t *termstatus.Terminal, stats Stats, data map[string]string) {
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
+// jobLines returns the status lines for the running jobs, ordered by the
+// worker running them so that the line for a job does not move around.
+func jobLines(running map[int]*runningJob, now time.Time) []string {
+	ids := make([]int, 0, len(running))
+	for id := range running {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := running[ids[i]], running[ids[j]]
+		if a.slot != b.slot {
+			return a.slot < b.slot
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	lines := make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		job := running[id]
+
+		line := fmt.Sprintf("%v %v %v", colorNumber(id), colorTag(job.tag), colorTimestamp(formatDuration(now.Sub(job.start))))
+		if job.hasProgress {
+			line += " " + progressBar(job.fraction)
+		}
+
+		if job.message != "" {
+			line += " " + job.message
+		}
+
+		lines = append(lines, line)
 	}
 
-	sort.Strings(keys)
+	return lines
+}
 
-	var status string
+func updateTerminal(t *termstatus.Terminal, stats Stats) {
+	itemRate.Add(time.Now(), stats.processed)
+
+	fields := statusFields{
+		Elapsed:    formatDuration(time.Since(stats.start)),
+		ETA:        "---",
+		Total:      stats.jobs,
+		TotalFinal: stats.jobsFinal,
+		Processed:  stats.processed,
+		Succeeded:  stats.processed - stats.failed,
+		Failed:     stats.failed,
+		Rate:       itemRate.Rate(),
+		AvgRate:    float64(stats.processed) / time.Since(stats.start).Seconds(),
+		Running:    len(stats.running),
+		Workers:    workerLimit(),
+	}
+
+	if stats.processed > 0 {
+		fields.SuccessPercent = 100 * float64(fields.Succeeded) / float64(stats.processed) //nolint:gomnd
+		fields.FailPercent = 100 * float64(stats.failed) / float64(stats.processed)        //nolint:gomnd
+	}
+
+	// fraction is the completion of the whole run, it is negative as long as
+	// the number of items is not known
+	fraction := -1.0
 
 	if stats.jobsFinal {
-		if etaEWMA == nil {
-			etaEWMA = newEWMA(stats.start, stats.jobs)
+		if etaEstimator == nil {
+			// the time per unit of work with all workers busy, known from
+			// the history before any job has finished
+			var seed time.Duration
+			if stats.perUnit.n > 0 {
+				seed = seconds(stats.perUnit.Mean()) / time.Duration(workerLimit())
+			}
+
+			etaEstimator = estimators[opts.eta](stats.start, stats.weight, seed)
 		}
 
-		etaEWMA.Report(stats.processed)
+		state := runState{
+			now:       time.Now(),
+			processed: stats.processedWeight,
+			perUnit:   stats.perUnit,
+			avgWeight: 1,
+			running:   stats.running,
+			workers:   workerLimit(),
+		}
+
+		if stats.jobs > 0 {
+			state.avgWeight = stats.weight / float64(stats.jobs)
+		}
+
+		etaEstimator.Report(state)
 
 		if time.Since(lastETAUpdate) > time.Second {
-			lastETA = etaEWMA.ETA()
+			lastETA, lastETAMargin = etaEstimator.ETA()
 			lastETAUpdate = time.Now()
 		}
 
-		eta := "---"
 		if lastETA > 0 {
-			eta = formatDuration(lastETA)
+			fields.ETA = formatDuration(lastETA)
 		}
 
-		status = fmt.Sprintf("[%s] %d/%d processed (%d failed) ETA %v, %d/%d workers:",
-			formatDuration(time.Since(stats.start)),
-			stats.processed,
-			stats.jobs,
-			stats.failed,
-			eta,
-			len(data),
-			opts.threads)
-	} else {
-		status = fmt.Sprintf("[%s] %d/%d+ processed (%d failed), %d/%d workers:",
-			formatDuration(time.Since(stats.start)),
-			stats.processed,
-			stats.jobs,
-			stats.failed,
-			len(data),
-			opts.threads)
+		if lastETA > 0 && lastETAMargin >= time.Second {
+			fields.ETAMargin = formatDuration(lastETAMargin)
+		}
+
+		fraction = 1
+		if stats.weight > 0 {
+			fraction = state.completed() / stats.weight
+		}
 	}
 
-	lines := make([]string, 0, len(data)+3) //nolint:gomnd
-	lines = append(lines, colorStatusLine(status))
+	width := terminalWidth()
+	if width <= 0 {
+		width = defaultTerminalWidth
+	}
 
-	for _, key := range keys {
-		lines = append(lines, data[key])
+	// the terminal cuts off the last two columns and the escape sequences
+	// for the color count as well
+	width -= 3 + len(colorStatusLine("")) //nolint:gomnd
+
+	status, err := renderStatus(statusFormat, fields, fraction, width)
+	if err != nil {
+		status = err.Error()
 	}
 
+	lines := make([]string, 0, len(stats.running)+3) //nolint:gomnd
+	lines = append(lines, colorStatusLine(status))
+	lines = append(lines, jobLines(stats.running, time.Now())...)
+
 	lineCount := len(lines)
 
 	if lineCount > smoothLines {
@@ -239,29 +469,101 @@ type Stats struct {
 
 	processed int
 	failed    int
+	oomKilled int
+
+	// weight is the total weight of all items, processedWeight the weight of
+	// the processed items
+	weight          float64
+	processedWeight float64
+
+	// perUnit contains the durations in seconds per unit of weight of the
+	// finished jobs
+	perUnit moments
+
+	// running contains the jobs which are currently running
+	running map[int]*runningJob
+
+	exitCodes exitHistogram
+	failures  []failure
+
+	// skipped contains the items which were not started before the deadline
+	skipped []string
+
+	// duplicates is the number of items skipped by --unique
+	duplicates int
+
+	usage usageSummary
+
+	// lastError contains the last line printed to stderr for each running job
+	lastError map[int]string
+}
+
+// printSummary prints the summary at the end of the run and writes the
+// failed items to a file if requested.
+func (stats *Stats) printSummary() {
+	var oom string
+	if stats.oomKilled > 0 {
+		oom = fmt.Sprintf(", %d killed by OOM", stats.oomKilled)
+	}
+
+	fmt.Fprintf(color.Output, "\nprocessed %d items (%d failures%s) in %s\n",
+		stats.processed,
+		stats.failed,
+		oom,
+		formatDuration(time.Since(stats.start)))
+
+	if stats.duplicates > 0 {
+		fmt.Fprintf(color.Output, "skipped %d duplicate items\n", stats.duplicates)
+	}
+
+	// only print the exit codes if any job has failed, successful jobs may also
+	// have exited with other codes than 0 (see --success-codes)
+	if stats.failed > 0 && len(stats.exitCodes) > 0 {
+		stats.exitCodes.Print(color.Output)
+	}
+
+	printFailures(color.Output, stats.failures)
+
+	if len(stats.skipped) > 0 {
+		fmt.Fprintf(color.Output, "%d items were not started before the deadline:\n", len(stats.skipped))
+
+		for _, tag := range stats.skipped {
+			fmt.Fprintf(color.Output, "  %v\n", colorTag(tag))
+		}
+	}
+
+	if opts.showUsage {
+		stats.usage.Print(color.Output)
+	}
+
+	if opts.failedOut != "" {
+		err := writeFailedItems(opts.failedOut, stats.failures)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing failed items failed: %v\n", err)
+		}
+	}
 }
 
 const statusUpdateInterval = 200 * time.Millisecond
 
-//nolint:gocognit
-func status(ctx context.Context, wg *sync.WaitGroup, t *termstatus.Terminal, outCh <-chan Status, inCount <-chan int) {
+func status(ctx context.Context, wg *sync.WaitGroup, t *termstatus.Terminal, outCh <-chan Status, inCount <-chan inputStats) {
 	defer wg.Done()
 
-	data := make(map[string]string)
-
 	ticker := time.NewTicker(statusUpdateInterval)
 	defer ticker.Stop()
 
 	stats := Stats{
-		start: time.Now(),
+		start:     time.Now(),
+		exitCodes: make(exitHistogram),
+		running:   make(map[int]*runningJob),
+		lastError: make(map[int]string),
 	}
 
-	defer func() {
-		fmt.Fprintf(color.Output, "\nprocessed %d items (%d failures) in %s\n",
-			stats.processed,
-			stats.failed,
-			formatDuration(time.Since(stats.start)))
-	}()
+	if jobHistory != nil {
+		stats.perUnit = jobHistory.PerUnit()
+	}
+
+	defer stats.printSummary()
 
 	for {
 		select {
@@ -272,45 +574,23 @@ func status(ctx context.Context, wg *sync.WaitGroup, t *termstatus.Terminal, out
 				return
 			}
 
-			var msg string
-			if s.Message != "" {
-				msg = s.Message
-				if s.Error {
-					msg = fmt.Sprintf("%v %v", colorError("error"), colorError(s.Message))
-				}
+			msg := formatMessage(s)
+			if msg != "" && !s.Progress {
+				t.Print(logPrefix(s) + msg)
 			}
 
-			if msg != "" {
-				m := ""
-				if !opts.hideJobID {
-					m += colorNumber(s.ID) + " "
-				}
-
-				if !opts.hideTimestamp {
-					m += colorTimestamp(time.Now().Format(timeFormat)) + " "
-				}
-
-				if !opts.hideName {
-					m += colorTag(s.Tag) + " "
-				}
-
-				t.Print(m + msg)
+			if s.Error && !s.Done && !s.Progress && s.Message != "" {
+				stats.lastError[s.ID] = s.Message
 			}
 
-			data[s.Tag] = fmt.Sprintf("%v %v", colorTag(s.Tag), msg)
+			stats.track(s, msg)
 
 			if s.Done {
-				stats.processed++
-
-				if s.Error {
-					stats.failed++
-				}
-
-				delete(data, s.Tag)
+				stats.finish(t, s)
 			}
 
-			updateTerminal(t, stats, data)
-		case jobNum, ok := <-inCount:
+			updateTerminal(t, stats)
+		case in, ok := <-inCount:
 			if !ok {
 				stats.jobsFinal = true
 				inCount = nil
@@ -318,10 +598,142 @@ func status(ctx context.Context, wg *sync.WaitGroup, t *termstatus.Terminal, out
 				continue
 			}
 
-			stats.jobs = jobNum
-			updateTerminal(t, stats, data)
+			stats.jobs = in.jobs
+			stats.weight = in.weight
+			stats.duplicates = in.duplicates
+			updateTerminal(t, stats)
 		case <-ticker.C:
-			updateTerminal(t, stats, data)
+			updateTerminal(t, stats)
+		}
+	}
+}
+
+// formatMessage returns the text logged for a status, which is empty if
+// nothing is to be logged.
+func formatMessage(s Status) string {
+	var msg string
+	if s.Message != "" {
+		msg = s.Message
+		if s.Error {
+			msg = fmt.Sprintf("%v %v", colorError("error"), colorError(s.Message))
+		}
+	}
+
+	if s.Done && opts.showUsage && s.Result != nil && s.Result.Usage != nil {
+		if msg != "" {
+			msg += ", "
+		}
+
+		msg += s.Result.Usage.String()
+	}
+
+	return msg
+}
+
+// logPrefix returns the job ID, time stamp and name logged in front of each
+// message, unless hidden.
+func logPrefix(s Status) string {
+	m := ""
+	if !opts.hideJobID {
+		m += colorNumber(s.ID) + " "
+	}
+
+	if !opts.hideTimestamp {
+		m += colorTimestamp(time.Now().Format(timeFormat)) + " "
+	}
+
+	if !opts.hideName {
+		m += colorTag(s.Tag) + " "
+	}
+
+	return m
+}
+
+// track updates the running jobs shown in the status lines.
+func (stats *Stats) track(s Status, msg string) {
+	if s.Start {
+		stats.running[s.ID] = &runningJob{
+			start:  time.Now(),
+			weight: s.Weight,
+			slot:   s.Slot,
+			tag:    s.Tag,
+		}
+	}
+
+	job, running := stats.running[s.ID]
+	if !running {
+		return
+	}
+
+	if progressRegex != nil && !s.Done {
+		if fraction, ok := progressFraction(progressRegex, sanitize(s.Message, false)); ok {
+			job.fraction = fraction
+			job.hasProgress = true
+		}
+	}
+
+	job.message = msg
+
+	if !s.Done {
+		return
+	}
+
+	stats.processedWeight += job.weight
+
+	if s.Result != nil && job.weight > 0 {
+		stats.perUnit.Add(s.Result.Duration.Seconds() / job.weight)
+	}
+
+	if jobHistory != nil && s.Result != nil && !s.Error {
+		jobHistory.Add(s.Tag, s.Result.Duration, job.weight)
+	}
+
+	delete(stats.running, s.ID)
+}
+
+// finish records the final status of a job.
+func (stats *Stats) finish(t *termstatus.Terminal, s Status) {
+	if s.Skipped {
+		stats.skipped = append(stats.skipped, s.Tag)
+
+		return
+	}
+
+	stats.processed++
+
+	if s.Error {
+		stats.failed++
+
+		f := failure{tag: s.Tag, reason: "error", message: s.Message}
+		if s.Result != nil {
+			f.reason = exitReason(s.Result)
+		}
+
+		if line, ok := stats.lastError[s.ID]; ok {
+			f.message = line
+		}
+
+		stats.failures = append(stats.failures, f)
+	}
+
+	delete(stats.lastError, s.ID)
+
+	if s.Result != nil && s.Result.Usage != nil {
+		stats.usage.Add(s.Tag, s.Result.Usage)
+	}
+
+	if s.Result != nil {
+		stats.exitCodes[exitReason(s.Result)]++
+
+		if s.Result.OOMKilled {
+			stats.oomKilled++
+		}
+	}
+
+	if joblog != nil {
+		err := joblog.Write(s)
+		if err != nil {
+			t.Errorf("writing job log failed: %v\n", err)
 		}
 	}
 }
@@ -335,19 +747,370 @@ func (t fakeTerminal) Fd() uintptr { return t.fd }
 
 const commandBuffer = 50000
 
-func main() {
+// Exit codes for errors detected before any job is started.
+const (
+	exitNoCommand     = 1
+	exitInvalidOption = 2
+)
+
+func defineFlags() {
 	pflag.IntVarP(&opts.threads, "procs", "p", runtime.NumCPU(), "number of parallel programs")
 	pflag.StringVar(&opts.placeholder, "replace", "{}", "replace this string in the command to run")
 	pflag.DurationVar(&opts.workerTimeout, "timeout", 0*time.Second, "set maximum runtime per queued job (0s == no limit)")
+	pflag.StringVar(&opts.timeoutFrom, "timeout-from", "", "take the timeout for each item from the item, e.g. {2}")
+	pflag.StringArrayVar(&opts.timeoutPatterns, "timeout-by-pattern", nil,
+		"set the timeout for items matching a glob pattern, e.g. '*.mkv=2h' (can be repeated)")
+	pflag.Float64Var(&opts.timeoutFactor, "timeout-factor", 0,
+		"kill jobs running longer than this factor times the median duration of finished jobs")
+	pflag.DurationVar(&opts.timeoutMin, "timeout-min", 10*time.Second, "minimum timeout for --timeout-factor")
+	pflag.StringVar(&opts.timeoutHistory, "timeout-history", "",
+		"use the durations from a previous --joblog `file` for --timeout-factor")
+	pflag.DurationVar(&opts.idleTimeout, "idle-timeout", 0,
+		"kill jobs which have not printed anything for this long (0s == no limit)")
+	pflag.DurationVar(&opts.deadline, "deadline", 0,
+		"stop starting jobs which would not finish within this time and kill all jobs afterwards")
+	pflag.StringVar(&opts.until, "until", "", "like --deadline, but at the next occurrence of this time of day, e.g. 06:00")
+	pflag.IntSliceVar(&opts.successCodes, "success-codes", []int{0}, "exit codes which are not considered a failure")
+	pflag.StringVar(&opts.failOnOutput, "fail-on-output", "",
+		"consider jobs printing a line matching this regular expression as failed")
+	pflag.BoolVar(&opts.failOnStderr, "fail-on-stderr", false, "consider jobs printing anything to stderr as failed")
+	pflag.StringVar(&opts.failedOut, "failed-out", "", "write the items of all failed jobs to `file`, in the input format")
+	pflag.DurationVar(&opts.drainTimeout, "output-drain-timeout", 2*time.Second,
+		"after a job has exited, stop showing the output of its background processes after this time")
+	pflag.BoolVar(&opts.pty, "pty", false, "run each job in a pseudo-terminal instead of with pipes for stdout and stderr (Linux)")
+	pflag.StringVar(&opts.progressRegex, "progress-regex", "",
+		"show a progress bar for each job, extracted from its output with this regular expression or preset (percent, fraction, curl)")
+	pflag.StringVar(&opts.statusFormat, "status-format", "",
+		"Go `template` or preset (default, detailed) for the first status line, e.g. '{{.Processed}}/{{.Total}} {{.Bar}}'")
+	pflag.StringVar(&opts.eta, "eta", "parallel", "estimator for the ETA: parallel, ewma or median (of the last items)")
+	pflag.StringVar(&opts.weightBy, "weight-by", "",
+		"weight items for the ETA by the file size (size) or by a number in the item, e.g. {2}")
+	pflag.BoolVar(&opts.history, "history", false,
+		"remember the duration of each item across runs of the same command, to estimate the ETA right from the start")
+	pflag.StringVar(&opts.order, "order", "input",
+		"order in which items are started: input or longest-first (needs --weight-by or --history)")
+	pflag.BoolVar(&opts.shuffle, "shuffle", false, "start the items in random order")
+	pflag.Int64Var(&opts.seed, "seed", 0, "seed for --shuffle, to get the same order again (0 == random)")
+	pflag.BoolVar(&opts.sort, "sort", false, "start the items in sorted order")
+	pflag.BoolVar(&opts.unique, "unique", false, "skip duplicate items")
+	pflag.BoolVar(&opts.fields, "fields", false, "also replace {1}, {2}, ... in the command with the fields of the item")
 	pflag.BoolVarP(&opts.useNullSeparator, "null", "0", false, "use null bytes as input separator")
 	pflag.BoolVar(&opts.hideJobID, "no-id", false, "hide the job id in the log")
 	pflag.BoolVar(&opts.hideTimestamp, "no-timestamp", false, "hide the time stamp in the log")
 	pflag.BoolVar(&opts.hideName, "no-name", false, "hide the job name in the log")
+	pflag.StringVar(&opts.rate, "rate", "", "start at most this many jobs per period, e.g. 5/s or 100/m")
+	pflag.DurationVar(&opts.delay, "delay", 0, "wait at least this long between starting two jobs")
+	pflag.BoolVar(&opts.adaptive, "adaptive", false,
+		"adjust the number of parallel programs to job durations and failures, up to --procs")
+	pflag.StringVar(&opts.limitBy, "limit-by", "", "run at most --limit jobs at once for items with the same key, e.g. {1}")
+	pflag.IntVar(&opts.limit, "limit", 1, "number of jobs which may run at once per key set by --limit-by")
+	pflag.StringVar(&opts.semaphore, "semaphore", "",
+		"share a pool of --slots job slots with other machma processes using this name")
+	pflag.IntVar(&opts.semaphoreSlots, "slots", runtime.NumCPU(), "number of job slots for --semaphore")
+	pflag.BoolVar(&opts.showUsage, "usage", false, "log the resource usage of each job and print a summary at the end")
+	pflag.StringVar(&opts.joblog, "joblog", "", "write information about each finished job as JSON lines to `file`")
+	pflag.StringVar(&opts.memLimit, "mem-limit", "", "limit the memory of each job, e.g. 512M (Linux, cgroup v2)")
+	pflag.StringVar(&opts.cpuQuota, "cpu-quota", "", "limit the CPU usage of each job, e.g. 1.5 or 50% (Linux, cgroup v2)")
+	pflag.IntVar(&opts.pidsLimit, "pids-limit", 0, "limit the number of processes of each job (Linux, cgroup v2)")
+	pflag.StringVar(&opts.cgroupParent, "cgroup-parent", "",
+		"create the cgroups for jobs below this delegated cgroup (default: the current cgroup)")
+	pflag.IntVar(&opts.nice, "nice", 0, "run jobs with this nice value")
+	pflag.StringVar(&opts.ioniceClass, "ionice-class", "",
+		"run jobs with this I/O scheduling class: idle, best-effort[:level] or realtime[:level] (Linux)")
+	pflag.BoolVar(&opts.pinCPUs, "pin-cpus", false, "pin the jobs of each worker to a different CPU (Linux)")
+}
+
+// parseOptions checks the options and sets up everything which is derived
+// from them. Nothing is created which would need to be cleaned up.
+func parseOptions() error {
+	err := parseStartOptions()
+	if err != nil {
+		return err
+	}
+
+	err = parseJobOptions()
+	if err != nil {
+		return err
+	}
+
+	err = parseDisplayOptions()
+	if err != nil {
+		return err
+	}
+
+	return parseDeadline()
+}
+
+// parseStartOptions checks the options which limit when jobs are started.
+func parseStartOptions() error {
+	if opts.rate != "" {
+		n, period, err := parseRate(opts.rate)
+		if err != nil {
+			return err
+		}
+
+		startLimiters = append(startLimiters, newRateLimiter(n, period))
+	}
+
+	if opts.delay > 0 {
+		startLimiters = append(startLimiters, newRateLimiter(1, opts.delay))
+	}
+
+	if opts.adaptive {
+		adaptive = newAdaptiveLimit(opts.threads)
+	}
+
+	err := checkLimit(pflag.CommandLine.Changed("limit"))
+	if err != nil {
+		return err
+	}
+
+	err = checkOrder(opts.order)
+	if err != nil {
+		return err
+	}
+
+	return checkWeightBy(opts.weightBy)
+}
+
+// parseJobOptions checks the options for running a single job.
+func parseJobOptions() error {
+	var err error
+
+	jobIOPriority, err = parseIOPriority(opts.ioniceClass)
+	if err != nil {
+		return err
+	}
+
+	jobLimits, err = parseLimits()
+	if err != nil {
+		return err
+	}
+
+	timeoutPatterns, err = parseTimeoutPatterns(opts.timeoutPatterns)
+	if err != nil {
+		return err
+	}
+
+	if opts.drainTimeout <= 0 {
+		return errors.New("--output-drain-timeout must be positive, the output of jobs would be lost otherwise")
+	}
+
+	if opts.pty && opts.failOnStderr {
+		return errors.New("--fail-on-stderr cannot be used with --pty, all output of a pseudo-terminal goes to stdout")
+	}
+
+	if opts.pty {
+		// make sure pseudo-terminals can be allocated before starting any job
+		master, slave, err := openPTY()
+		if err != nil {
+			return err
+		}
+
+		_ = master.Close()
+		_ = slave.Close()
+	}
+
+	successCodes = make(map[int]bool)
+	for _, code := range opts.successCodes {
+		successCodes[code] = true
+	}
+
+	if opts.failOnOutput != "" {
+		failOnOutput, err = regexp.Compile(opts.failOnOutput)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression for --fail-on-output: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// parseDisplayOptions checks the options for the status lines.
+func parseDisplayOptions() error {
+	var err error
+
+	if opts.progressRegex != "" {
+		progressRegex, err = parseProgressRegex(opts.progressRegex)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.statusFormat != "" {
+		statusFormat, err = parseStatusFormat(opts.statusFormat)
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkEstimator(opts.eta)
+}
+
+// parseDeadline sets the deadline from --deadline and --until.
+func parseDeadline() error {
+	if opts.deadline > 0 {
+		deadline = time.Now().Add(opts.deadline)
+	}
+
+	if opts.until != "" {
+		until, err := parseUntil(opts.until, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if deadline.IsZero() || until.Before(deadline) {
+			deadline = until
+		}
+	}
+
+	return nil
+}
+
+// setup creates the files and cgroups needed for running the command. The
+// returned function cleans up again, it must also be called if an error is
+// returned.
+func setup(command []string) (cleanup func(), err error) {
+	var cleanups []func()
+
+	cleanup = func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	if opts.semaphore != "" {
+		globalSemaphore, err = openSemaphore(opts.semaphore, opts.semaphoreSlots)
+		if err != nil {
+			return cleanup, err
+		}
+	}
+
+	if opts.history {
+		jobHistory, err = loadHistory(command)
+		if err != nil {
+			return cleanup, err
+		}
+	}
+
+	if opts.timeoutHistory != "" {
+		durations, err := readJobLogDurations(opts.timeoutHistory)
+		if err != nil {
+			return cleanup, err
+		}
+
+		for _, d := range durations {
+			jobDurations.Add(d)
+		}
+	}
+
+	if opts.joblog != "" {
+		joblog, err = createJobLog(opts.joblog)
+		if err != nil {
+			return cleanup, err
+		}
+
+		cleanups = append(cleanups, func() {
+			_ = joblog.Close()
+		})
+	}
+
+	if jobLimits.enabled() {
+		cgroups, err = newCgroupManager(opts.cgroupParent, jobLimits)
+		if err != nil {
+			return cleanup, err
+		}
+
+		cleanups = append(cleanups, cgroups.Close)
+	}
+
+	if needShim() {
+		shimExecutable, err = os.Executable()
+		if err != nil {
+			return cleanup, err
+		}
+
+		err = checkShim()
+		if err != nil {
+			return cleanup, err
+		}
+	}
+
+	return cleanup, nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == shimArg {
+		os.Exit(runShim(os.Args[2:]))
+	}
+
+	os.Exit(run())
+}
+
+// run starts the jobs and returns the exit code. All options are checked before
+// anything which needs to be cleaned up (like cgroups) is created.
+func run() int {
+	defineFlags()
 	pflag.Parse()
 
+	err := parseOptions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return exitInvalidOption
+	}
+
+	args := pflag.Args()
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "no command given\n")
+		pflag.Usage()
+
+		return exitNoCommand
+	}
+
+	err = checkForPlaceholder(args[0], args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return exitInvalidOption
+	}
+
+	cleanup, err := setup(args)
+	defer cleanup()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+
+		return exitInvalidOption
+	}
+
+	runJobs(args[0], args[1:])
+
+	if jobHistory != nil {
+		err := jobHistory.Save()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "saving the history failed: %v\n", err)
+		}
+	}
+
+	return 0
+}
+
+// runJobs runs the command for all items read from stdin.
+func runJobs(cmdname string, args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// jobCtx is cancelled when the deadline is reached
+	jobCtx := context.Background()
+
+	if !deadline.IsZero() {
+		var jobCancel context.CancelFunc
+
+		jobCtx, jobCancel = context.WithDeadline(jobCtx, deadline)
+		defer jobCancel()
+	}
+
 	var t *termstatus.Terminal
 	if runtime.GOOS == "windows" {
 		t = termstatus.New(&fakeTerminal{color.Output, os.Stdout.Fd()}, os.Stderr, false)
@@ -356,7 +1119,7 @@ func main() {
 	}
 
 	outCh := make(chan Status)
-	jobNumCh := make(chan int)
+	inputCh := make(chan inputStats)
 
 	var statusWg sync.WaitGroup
 
@@ -369,35 +1132,26 @@ func main() {
 
 	statusWg.Add(1)
 
-	go status(ctx, &statusWg, t, outCh, jobNumCh)
+	go status(ctx, &statusWg, t, outCh, inputCh)
 
 	ch := make(chan *Command, commandBuffer)
 
+	sched := newScheduler(0)
+	if opts.limitBy != "" {
+		sched = newScheduler(opts.limit)
+	}
+
+	go sched.Feed(ch)
+
 	var workersWg sync.WaitGroup
 
 	for i := 0; i < opts.threads; i++ {
 		workersWg.Add(1)
 
-		go worker(&workersWg, ch, outCh)
+		go worker(jobCtx, &workersWg, i, sched, outCh)
 	}
 
-	args := pflag.Args()
-	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "no command given\n")
-		pflag.Usage()
-
-		// yes, I know, calling os.Exit() ignores the defer "cancel()" call at
-		// the beginning of main(), but we're quitting the process here so it
-		// doesn't matter
-		os.Exit(1) //nolint:gocritic
-	}
-
-	cmdname := args[0]
-	args = args[1:]
-
-	checkForPlaceholder(cmdname, args)
-
-	go parseInput(ch, jobNumCh, cmdname, args)
+	go parseInput(ch, inputCh, cmdname, args)
 
 	workersWg.Wait()
 	close(outCh)
@@ -2,9 +2,15 @@ package main
 
 import (
 	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/fatih/color"
 )
 
 var nullTests = []struct {
@@ -38,3 +44,159 @@ func TestScanNullSeparatedValues(t *testing.T) {
 		}
 	}
 }
+
+var templateTests = []struct {
+	tmpl   string
+	item   string
+	output string
+}{
+	{"{}", "foo bar", "foo bar"},
+	{"{1}", "host1 /dev/sda", "host1"},
+	{"{2}:{1}", "host1 /dev/sda", "/dev/sda:host1"},
+	{"{3}", "host1 /dev/sda", ""},
+	{"x{}y", "a", "xay"},
+	{"{} {1}", "{1}", "{1} {1}"},
+}
+
+func TestExpandTemplate(t *testing.T) {
+	oldPlaceholder := opts.placeholder
+	defer func() {
+		opts.placeholder = oldPlaceholder
+	}()
+
+	opts.placeholder = "{}"
+
+	for i, test := range templateTests {
+		output := expandTemplate(test.tmpl, test.item, strings.Fields(test.item))
+		if output != test.output {
+			t.Errorf("test %d failed: want %q, got %q", i, test.output, output)
+		}
+	}
+}
+
+var commandTests = []struct {
+	fields bool
+	arg    string
+	item   string
+	output string
+}{
+	{false, "o{2}", "xx.txt", "o{2}"},
+	{false, "{}", "foo bar", "foo bar"},
+	{false, "{2}:{}", "host1 /dev/sda", "{2}:host1 /dev/sda"},
+	{true, "{2}:{1}", "host1 /dev/sda", "/dev/sda:host1"},
+	{true, "{}", "foo bar", "foo bar"},
+}
+
+func TestExpandCommand(t *testing.T) {
+	oldPlaceholder, oldFields := opts.placeholder, opts.fields
+	defer func() {
+		opts.placeholder, opts.fields = oldPlaceholder, oldFields
+	}()
+
+	opts.placeholder = "{}"
+
+	for i, test := range commandTests {
+		opts.fields = test.fields
+
+		output := expandCommand(test.arg, test.item, strings.Fields(test.item))
+		if output != test.output {
+			t.Errorf("test %d failed: want %q, got %q", i, test.output, output)
+		}
+	}
+}
+
+func TestJobLines(t *testing.T) {
+	defer func(noColor bool) {
+		color.NoColor = noColor
+	}(color.NoColor)
+
+	color.NoColor = true
+
+	now := time.Now()
+
+	// the same item running twice gets two lines, ordered by slot
+	running := map[int]*runningJob{
+		5: {slot: 0, tag: "foo", start: now.Add(-3 * time.Second), message: "working"},
+		2: {slot: 1, tag: "foo", start: now.Add(-65 * time.Second)},
+		7: {slot: 0, tag: "bar", start: now, fraction: 0.5, hasProgress: true, message: "50%"},
+	}
+
+	want := []string{
+		"5 foo 0:03 working",
+		"7 bar 0:00 [#####     ]  50% 50%",
+		"2 foo 1:05",
+	}
+
+	lines := jobLines(running, now)
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("want %q, got %q", want, lines)
+	}
+}
+
+func TestParseInputIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	defer func(stdin *os.File, unique bool, placeholder string) {
+		os.Stdin, opts.unique, opts.placeholder = stdin, unique, placeholder
+	}(os.Stdin, opts.unique, opts.placeholder)
+
+	opts.placeholder = "{}"
+
+	var tests = []struct {
+		unique bool
+		ids    map[string]int
+		jobs   int
+	}{
+		// IDs count all lines, also empty ones
+		{false, map[string]int{"a": 4, "b": 3, "c": 5}, 5},
+		// duplicates keep their ID, but are not counted
+		{true, map[string]int{"a": 1, "b": 3, "c": 5}, 4},
+	}
+
+	filename := filepath.Join(dir, "input")
+
+	err = ioutil.WriteFile(filename, []byte("a\n\nb\na\nc\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range tests {
+		opts.unique = test.unique
+
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Stdin = f
+
+		ch := make(chan *Command, 10)
+		inputCh := make(chan inputStats, 10)
+
+		parseInput(ch, inputCh, "echo", []string{"{}"})
+
+		_ = f.Close()
+
+		ids := make(map[string]int)
+		for c := range ch {
+			ids[c.Tag] = c.ID
+		}
+
+		var stats inputStats
+		for stats = range inputCh {
+		}
+
+		if !reflect.DeepEqual(test.ids, ids) {
+			t.Errorf("test %d failed: want IDs %v, got %v", i, test.ids, ids)
+		}
+
+		if stats.jobs != test.jobs {
+			t.Errorf("test %d failed: want %v jobs, got %v", i, test.jobs, stats.jobs)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// checkOrder returns an error if the value for --order is invalid or
+// conflicts with --shuffle or --sort.
+func checkOrder(order string) error {
+	n := 0
+
+	for _, set := range []bool{order != "input", opts.shuffle, opts.sort} {
+		if set {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return errors.New("only one of --order, --shuffle and --sort can be used")
+	}
+
+	if opts.seed != 0 && !opts.shuffle {
+		return errors.New("--seed can only be used with --shuffle")
+	}
+
+	switch order {
+	case "input":
+		return nil
+	case "longest-first":
+		if opts.weightBy == "" && !opts.history {
+			return errors.New("--order longest-first needs --weight-by or --history to estimate the cost of the items")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown order %q, valid are: input, longest-first", order)
+}
+
+// orderedInput returns true if the input needs to be read completely before
+// the first command is started.
+func orderedInput() bool {
+	return opts.order == "longest-first" || opts.shuffle || opts.sort
+}
+
+// itemCost estimates the duration of a command in seconds: the duration of the
+// item in the previous run if the history contains the item, otherwise the
+// weight of the item converted with the durations per unit of weight in the
+// history. ok is false if no duration can be estimated.
+func itemCost(c *Command, perUnit moments) (cost float64, ok bool) {
+	if jobHistory != nil {
+		if d, ok := jobHistory.Duration(c.Tag); ok {
+			return d.Seconds(), true
+		}
+	}
+
+	if perUnit.n > 0 {
+		return c.Weight * perUnit.Mean(), true
+	}
+
+	return 0, false
+}
+
+// sortCommands sorts the commands according to --order, --shuffle or --sort.
+func sortCommands(cmds []*Command) {
+	switch {
+	case opts.shuffle:
+		seed := opts.seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+
+		rnd := rand.New(rand.NewSource(seed))
+		rnd.Shuffle(len(cmds), func(i, j int) {
+			cmds[i], cmds[j] = cmds[j], cmds[i]
+		})
+
+		return
+	case opts.sort:
+		sort.SliceStable(cmds, func(i, j int) bool {
+			return cmds[i].Tag < cmds[j].Tag
+		})
+
+		return
+	case opts.order != "longest-first":
+		return
+	}
+
+	var perUnit moments
+	if jobHistory != nil {
+		perUnit = jobHistory.PerUnit()
+	}
+
+	costs := make(map[*Command]float64, len(cmds))
+	estimated := make(map[*Command]bool, len(cmds))
+
+	for _, c := range cmds {
+		costs[c], estimated[c] = itemCost(c, perUnit)
+	}
+
+	// commands with an estimated duration come first, the others follow
+	// ordered by their weight, which cannot be compared to a duration
+	sort.SliceStable(cmds, func(i, j int) bool {
+		a, b := cmds[i], cmds[j]
+
+		switch {
+		case estimated[a] != estimated[b]:
+			return estimated[a]
+		case estimated[a]:
+			return costs[a] > costs[b]
+		default:
+			return a.Weight > b.Weight
+		}
+	})
+
+	// keep the order in the scheduler
+	for i, c := range cmds {
+		c.Priority = len(cmds) - i
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortCommands(t *testing.T) {
+	defer func() {
+		opts.order = "input"
+		opts.sort = false
+	}()
+
+	var tests = []struct {
+		order   string
+		sort    bool
+		weights []float64
+		ids     []int
+	}{
+		{"input", false, []float64{1, 3, 2}, []int{1, 2, 3}},
+		{"longest-first", false, []float64{1, 3, 2}, []int{2, 3, 1}},
+		{"longest-first", false, []float64{1, 2, 1, 2}, []int{2, 4, 1, 3}},
+		{"input", true, []float64{1, 1, 1, 1}, []int{3, 1, 2, 4}},
+	}
+
+	tags := []string{"b", "c", "a", "d"}
+
+	for i, test := range tests {
+		opts.order = test.order
+		opts.sort = test.sort
+
+		var cmds []*Command
+		for j, weight := range test.weights {
+			cmds = append(cmds, &Command{ID: j + 1, Weight: weight, Tag: tags[j]})
+		}
+
+		sortCommands(cmds)
+
+		for j, c := range cmds {
+			if c.ID != test.ids[j] {
+				t.Errorf("test %d failed: want order %v, got command %v at position %v", i, test.ids, c.ID, j)
+
+				break
+			}
+		}
+	}
+}
+
+func TestSortCommandsHistory(t *testing.T) {
+	defer func(h *history, order string) {
+		jobHistory, opts.order = h, order
+	}(jobHistory, opts.order)
+
+	opts.order = "longest-first"
+
+	var tests = []struct {
+		history map[string]*historyEntry
+		weights []float64
+		ids     []int
+	}{
+		// all durations known from the history
+		{
+			map[string]*historyEntry{"a": {Duration: 1}, "b": {Duration: 9}, "c": {Duration: 5}},
+			[]float64{1, 1, 1, 1},
+			[]int{2, 3, 1, 4},
+		},
+		// items which are not in the history come last, by weight
+		{
+			map[string]*historyEntry{"a": {Duration: 1}, "c": {Duration: 5}},
+			[]float64{1, 100, 1, 200},
+			[]int{3, 1, 4, 2},
+		},
+		// weights are converted to durations with the history
+		{
+			map[string]*historyEntry{"a": {Duration: 4, Weight: 2}},
+			[]float64{2, 1, 3, 5},
+			[]int{4, 3, 1, 2},
+		},
+	}
+
+	tags := []string{"a", "b", "c", "d"}
+
+	for i, test := range tests {
+		jobHistory = &history{data: historyFile{Items: test.history}}
+
+		var cmds []*Command
+		for j, weight := range test.weights {
+			cmds = append(cmds, &Command{ID: j + 1, Weight: weight, Tag: tags[j]})
+		}
+
+		sortCommands(cmds)
+
+		ids := make([]int, 0, len(cmds))
+		for j, c := range cmds {
+			ids = append(ids, c.ID)
+
+			if c.Priority != len(cmds)-j {
+				t.Errorf("test %d failed: want priority %v for command %v, got %v", i, len(cmds)-j, c.ID, c.Priority)
+			}
+		}
+
+		if !reflect.DeepEqual(test.ids, ids) {
+			t.Errorf("test %d failed: want order %v, got %v", i, test.ids, ids)
+		}
+	}
+}
+
+func shuffledIDs(n int) []int {
+	cmds := make([]*Command, 0, n)
+	for i := 0; i < n; i++ {
+		cmds = append(cmds, &Command{ID: i + 1})
+	}
+
+	sortCommands(cmds)
+
+	ids := make([]int, 0, n)
+	for _, c := range cmds {
+		ids = append(ids, c.ID)
+	}
+
+	return ids
+}
+
+func TestShuffleCommands(t *testing.T) {
+	defer func() {
+		opts.shuffle = false
+		opts.seed = 0
+	}()
+
+	opts.shuffle = true
+	opts.seed = 23
+
+	ids := shuffledIDs(100)
+
+	if !reflect.DeepEqual(ids, shuffledIDs(100)) {
+		t.Errorf("shuffling with the same seed returned a different order")
+	}
+
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+
+	if len(seen) != 100 {
+		t.Errorf("shuffled commands are not a permutation: %v", ids)
+	}
+
+	sorted := true
+
+	for i, id := range ids {
+		if id != i+1 {
+			sorted = false
+		}
+	}
+
+	if sorted {
+		t.Errorf("commands have not been shuffled")
+	}
+}
+
+func TestCheckOrder(t *testing.T) {
+	defer func() {
+		opts.shuffle = false
+		opts.sort = false
+		opts.weightBy = ""
+		opts.seed = 0
+	}()
+
+	var tests = []struct {
+		order    string
+		shuffle  bool
+		sort     bool
+		weightBy string
+		seed     int64
+		valid    bool
+	}{
+		{"input", false, false, "", 0, true},
+		{"input", true, false, "", 0, true},
+		{"input", false, true, "", 0, true},
+		{"input", true, true, "", 0, false},
+		{"longest-first", false, false, "size", 0, true},
+		{"longest-first", false, false, "", 0, false},
+		{"longest-first", true, false, "size", 0, false},
+		{"foo", false, false, "", 0, false},
+		{"input", true, false, "", 23, true},
+		{"input", false, false, "", 23, false},
+		{"input", false, true, "", 23, false},
+	}
+
+	for i, test := range tests {
+		opts.shuffle = test.shuffle
+		opts.sort = test.sort
+		opts.weightBy = test.weightBy
+		opts.seed = test.seed
+
+		err := checkOrder(test.order)
+		if (err == nil) != test.valid {
+			t.Errorf("test %d failed: want valid %v, got error %v", i, test.valid, err)
+		}
+	}
+}
+
+func TestItemCost(t *testing.T) {
+	defer func(h *history) {
+		jobHistory = h
+	}(jobHistory)
+
+	jobHistory = &history{data: historyFile{Items: map[string]*historyEntry{
+		"known": {Duration: 30, Weight: 10},
+	}}}
+
+	var tests = []struct {
+		tag     string
+		weight  float64
+		perUnit moments
+		cost    float64
+		ok      bool
+	}{
+		{"known", 5, moments{}, 30, true},
+		{"known", 5, moments{n: 1, sum: 2}, 30, true},
+		{"new", 5, moments{n: 2, sum: 4}, 10, true},
+		{"new", 5, moments{}, 0, false},
+	}
+
+	for i, test := range tests {
+		cost, ok := itemCost(&Command{Tag: test.tag, Weight: test.weight}, test.perUnit)
+		if cost != test.cost || ok != test.ok {
+			t.Errorf("test %d failed: want %v (%v), got %v (%v)", i, test.cost, test.ok, cost, ok)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// I/O scheduling classes, as used by ioprio_set(2) on Linux.
+const (
+	ioClassNone       = 0
+	ioClassRealtime   = 1
+	ioClassBestEffort = 2
+	ioClassIdle       = 3
+)
+
+// ioPriority is the I/O scheduling class and level for jobs.
+type ioPriority struct {
+	class int
+	level int
+}
+
+// ioPriorityDefaultLevel is used when no level is given for the realtime and
+// best-effort classes.
+const ioPriorityDefaultLevel = 4
+
+// parseIOPriority parses an I/O scheduling class like "idle", "best-effort"
+// or "realtime", optionally followed by a level from 0 (highest) to 7 (lowest),
+// e.g. "best-effort:7".
+func parseIOPriority(s string) (ioPriority, error) {
+	if s == "" {
+		return ioPriority{}, nil
+	}
+
+	name := s
+	level := ioPriorityDefaultLevel
+
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name = s[:i]
+
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 0 || n > 7 {
+			return ioPriority{}, fmt.Errorf("invalid I/O priority level in %q, must be 0 to 7", s)
+		}
+
+		level = n
+	}
+
+	switch name {
+	case "idle":
+		return ioPriority{class: ioClassIdle}, nil
+	case "best-effort":
+		return ioPriority{class: ioClassBestEffort, level: level}, nil
+	case "realtime":
+		return ioPriority{class: ioClassRealtime, level: level}, nil
+	}
+
+	return ioPriority{}, fmt.Errorf("invalid I/O scheduling class %q, use idle, best-effort or realtime", name)
+}
+
+// jobIOPriority is applied to all jobs if the class is set.
+var jobIOPriority ioPriority
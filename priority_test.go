@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+var ioPriorityTests = []struct {
+	input string
+	prio  ioPriority
+	err   bool
+}{
+	{"", ioPriority{}, false},
+	{"idle", ioPriority{class: ioClassIdle}, false},
+	{"best-effort", ioPriority{class: ioClassBestEffort, level: 4}, false},
+	{"best-effort:7", ioPriority{class: ioClassBestEffort, level: 7}, false},
+	{"realtime:0", ioPriority{class: ioClassRealtime, level: 0}, false},
+	{"realtime:8", ioPriority{}, true},
+	{"foo", ioPriority{}, true},
+}
+
+func TestParseIOPriority(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range ioPriorityTests {
+		prio, err := parseIOPriority(test.input)
+		if test.err != (err != nil) {
+			t.Errorf("test %d failed: unexpected error value %v", i, err)
+
+			continue
+		}
+
+		if prio != test.prio {
+			t.Errorf("test %d failed: want %+v, got %+v", i, test.prio, prio)
+		}
+	}
+}
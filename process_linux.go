@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprio_set(2) constants
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+)
+
+// setIOPriority sets the I/O scheduling class and level for the process group
+// of the process.
+func setIOPriority(pid int, prio ioPriority) error {
+	value := prio.class<<ioprioClassShift | prio.level
+
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pid), uintptr(value))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// pinCPU restricts the process to a single CPU. The slot is mapped to the
+// CPUs machma itself may run on, so slot i is pinned to the i-th of them.
+func pinCPU(pid, slot int) error {
+	var allowed unix.CPUSet
+
+	err := unix.SchedGetaffinity(0, &allowed)
+	if err != nil {
+		return err
+	}
+
+	count := allowed.Count()
+	if count == 0 {
+		return errors.New("no CPUs available")
+	}
+
+	n := slot % count
+
+	for cpu := 0; ; cpu++ {
+		if !allowed.IsSet(cpu) {
+			continue
+		}
+
+		if n > 0 {
+			n--
+
+			continue
+		}
+
+		var set unix.CPUSet
+
+		set.Set(cpu)
+
+		return unix.SchedSetaffinity(pid, &set)
+	}
+}
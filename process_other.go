@@ -0,0 +1,15 @@
+// +build !linux,!windows
+
+package main
+
+import (
+	"errors"
+)
+
+func setIOPriority(pid int, prio ioPriority) error {
+	return errors.New("setting the I/O priority is only supported on Linux")
+}
+
+func pinCPU(pid, slot int) error {
+	return errors.New("pinning jobs to CPUs is only supported on Linux")
+}
@@ -3,8 +3,11 @@
 package main
 
 import (
+	"os"
 	"os/exec"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func createProcessGroup(cmd *exec.Cmd) {
@@ -17,3 +20,19 @@ func createProcessGroup(cmd *exec.Cmd) {
 func killProcessGroup(cmd *exec.Cmd) error {
 	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 }
+
+// setNice sets the nice value for the process group of the process.
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+}
+
+// exitSignal returns the name of the signal which terminated the process, or
+// the empty string if it exited normally.
+func exitSignal(state *os.ProcessState) string {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+
+	return unix.SignalName(ws.Signal())
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"os"
 	"os/exec"
 )
 
@@ -11,3 +13,21 @@ func createProcessGroup(cmd *exec.Cmd) {
 func killProcessGroup(cmd *exec.Cmd) error {
 	return cmd.Process.Kill()
 }
+
+func setNice(pid, nice int) error {
+	return errors.New("setting the nice value is not supported on Windows")
+}
+
+func setIOPriority(pid int, prio ioPriority) error {
+	return errors.New("setting the I/O priority is only supported on Linux")
+}
+
+func pinCPU(pid, slot int) error {
+	return errors.New("pinning jobs to CPUs is only supported on Linux")
+}
+
+// exitSignal returns the empty string, processes are not terminated by
+// signals on Windows.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
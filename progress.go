@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// curlSize and curlTime match the sizes (e.g. "512", "100M" or "45.2M") and the
+// times (e.g. "0:00:09", "--:--:--" or "4d 03h") in the progress meter of curl.
+const (
+	curlSize = `\d+(?:\.\d)?[kMGTP]?`
+	curlTime = `(?:--:--:--|\d+:\d\d:\d\d|\d+d \d\dh|\d+d)`
+)
+
+// progressPresets contains regular expressions for --progress-regex which
+// match the progress output of common tools.
+var progressPresets = map[string]string{
+	// a percentage, e.g. "45%" or "45.3 %", printed by rsync, wget, git and many others
+	"percent": `(\d+(?:\.\d+)?)\s*%`,
+	// a number of items out of a total, e.g. "12/50" or "12 of 50"
+	"fraction": `(\d+)\s*(?:/|of)\s*(\d+)`,
+	// the first column of the progress meter of curl, the whole line must match
+	// the twelve columns of the meter so that other lines starting with a
+	// number are ignored
+	"curl": `^\s*(\d+)\s+` + curlSize + `\s+\d+\s+` + curlSize + `\s+\d+\s+` + curlSize +
+		`\s+` + curlSize + `\s+` + curlSize +
+		`\s+` + curlTime + `\s+` + curlTime + `\s+` + curlTime + `\s+` + curlSize + `\s*$`,
+}
+
+// progressRegex extracts the completion of a job from its output, it is nil if
+// --progress-regex is not used.
+var progressRegex *regexp.Regexp
+
+// parseProgressRegex returns the regular expression for the name of a preset
+// or a regular expression. It must contain either one group matching a
+// percentage, or two groups matching the number of completed and total items.
+func parseProgressRegex(s string) (*regexp.Regexp, error) {
+	if preset, ok := progressPresets[s]; ok {
+		s = preset
+	}
+
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression for --progress-regex: %w", err)
+	}
+
+	if n := re.NumSubexp(); n != 1 && n != 2 {
+		return nil, fmt.Errorf("--progress-regex must contain one or two groups, found %d", n)
+	}
+
+	return re, nil
+}
+
+// progressFraction returns the completion of a job between 0 and 1 extracted
+// from a line printed by the job. If the line contains several matches, the
+// last one is used.
+func progressFraction(re *regexp.Regexp, line string) (float64, bool) {
+	matches := re.FindAllStringSubmatch(line, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+
+	m := matches[len(matches)-1]
+
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	var fraction float64
+
+	if len(m) == 3 { //nolint:gomnd
+		total, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || total == 0 {
+			return 0, false
+		}
+
+		fraction = value / total
+	} else {
+		fraction = value / 100 //nolint:gomnd
+	}
+
+	switch {
+	case fraction < 0:
+		fraction = 0
+	case fraction > 1:
+		fraction = 1
+	}
+
+	return fraction, true
+}
+
+// progressBarWidth is the number of characters inside the progress bar of a
+// job.
+const progressBarWidth = 10
+
+// renderBar renders a progress bar with width characters between the brackets.
+func renderBar(fraction float64, width int) string {
+	filled := int(fraction * float64(width))
+	if filled > width {
+		filled = width
+	}
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+// progressBar renders a small progress bar like "[####      ]  45%".
+func progressBar(fraction float64) string {
+	return fmt.Sprintf("%s %3d%%", renderBar(fraction, progressBarWidth), int(fraction*100)) //nolint:gomnd
+}
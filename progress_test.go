@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+var progressFractionTests = []struct {
+	regex    string
+	line     string
+	ok       bool
+	fraction float64
+}{
+	{"percent", "foo", false, 0},
+	{"percent", "45%", true, 0.45},
+	{"percent", "copying 12.5 % done", true, 0.125},
+	{"percent", "10% 20% 30%", true, 0.3},
+	{"percent", "150%", true, 1},
+	{"fraction", "file 3/4", true, 0.75},
+	{"fraction", "item 1 of 4", true, 0.25},
+	{"fraction", "0/0", false, 0},
+	{"curl", " 42  100M   42 42.0M    0     0  10.0M      0  0:00:10  0:00:04  0:00:06 10.0M", true, 0.42},
+	{"curl", "  % Total    % Received % Xferd", false, 0},
+	{"curl", "  0     0    0     0    0     0      0      0 --:--:-- --:--:-- --:--:--     0", true, 0},
+	{"curl", "  7 1024G    7 75.1G    0     0  1024k      0 12d 03h  0d 02h 11d 23h  998k", true, 0.07},
+	{"curl", "100  512    100  512    0     0   1234      0  0:00:01  0:00:01 --:--:--  1234", true, 1},
+	{"curl", "100 19.0M  100 19.0M    0     0  4035M      0 --:--:-- --:--:-- --:--:-- 4035M", true, 1},
+	{"curl", "42 files copied", false, 0},
+	{"curl", " 42  100M   42 42.0M", false, 0},
+	{`step (\d+) of (\d+)`, "step 2 of 8", true, 0.25},
+}
+
+func TestProgressFraction(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range progressFractionTests {
+		re, err := parseProgressRegex(test.regex)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+			continue
+		}
+
+		fraction, ok := progressFraction(re, test.line)
+		if ok != test.ok {
+			t.Errorf("test %d failed: want %v, got %v", i, test.ok, ok)
+			continue
+		}
+
+		if fraction != test.fraction {
+			t.Errorf("test %d failed: want %v, got %v", i, test.fraction, fraction)
+		}
+	}
+}
+
+func TestParseProgressRegexInvalid(t *testing.T) {
+	t.Parallel()
+
+	for i, regex := range []string{"(", `\d+%`, `(\d+)/(\d+)/(\d+)`} {
+		_, err := parseProgressRegex(regex)
+		if err == nil {
+			t.Errorf("test %d failed: expected error for %q", i, regex)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		fraction float64
+		bar      string
+	}{
+		{0, "[          ]   0%"},
+		{0.45, "[####      ]  45%"},
+		{1, "[##########] 100%"},
+	}
+
+	for i, test := range tests {
+		bar := progressBar(test.fraction)
+		if bar != test.bar {
+			t.Errorf("test %d failed: want %q, got %q", i, test.bar, bar)
+		}
+	}
+}
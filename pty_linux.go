@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// size of the pseudo-terminal allocated for jobs
+const (
+	ptyRows = 24
+	ptyCols = 120
+)
+
+// openPTY allocates a new pseudo-terminal and returns both ends.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// use the raw file descriptor via SyscallConn, calling Fd() would put the
+	// file into blocking mode and Close() would not interrupt a pending Read()
+	rawConn, err := master.SyscallConn()
+	if err != nil {
+		_ = master.Close()
+
+		return nil, nil, err
+	}
+
+	var n int
+
+	cerr := rawConn.Control(func(fd uintptr) {
+		err = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0)
+		if err != nil {
+			err = fmt.Errorf("unlocking pty failed: %w", err)
+
+			return
+		}
+
+		n, err = unix.IoctlGetInt(int(fd), unix.TIOCGPTN)
+		if err != nil {
+			err = fmt.Errorf("getting pty number failed: %w", err)
+
+			return
+		}
+
+		err = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: ptyRows, Col: ptyCols})
+		if err != nil {
+			err = fmt.Errorf("setting pty size failed: %w", err)
+		}
+	})
+
+	if cerr != nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = master.Close()
+
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// setControllingTerminal makes the process start a new session with its stdout
+// as the controlling terminal. The session also is a new process group, so it
+// can be killed like the process group created by createProcessGroup.
+func setControllingTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    1, // file descriptor of stdout in the child
+	}
+}
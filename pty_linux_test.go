@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPTY(t *testing.T) {
+	defer func(pty bool, drainTimeout time.Duration) {
+		opts.pty, opts.drainTimeout = pty, drainTimeout
+	}(opts.pty, opts.drainTimeout)
+
+	opts.pty = true
+	opts.drainTimeout = 2 * time.Second
+
+	script := `test -t 1 && echo tty; ` +
+		`exec 3</dev/tty && echo ctty; ` +
+		`printf 'working\rdone\n'; ` +
+		`read x || echo eof`
+
+	c := &Command{Tag: "test", ID: 1, Cmd: "sh", Args: []string{"-c", script}}
+
+	outCh := make(chan Status)
+	collected := make(chan []Status)
+
+	go func() {
+		var list []Status
+		for s := range outCh {
+			list = append(list, s)
+		}
+		collected <- list
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.Run(ctx, outCh)
+	close(outCh)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type line struct {
+		message  string
+		progress bool
+	}
+
+	var lines []line
+	for _, s := range <-collected {
+		if s.Error {
+			t.Errorf("unexpected error status %q, the output of a pseudo-terminal is stdout", s.Message)
+		}
+
+		lines = append(lines, line{s.Message, s.Progress})
+	}
+
+	// the terminal translates "\n" to "\r\n", which must not be mistaken for
+	// progress messages
+	want := []line{
+		{"tty", false},
+		{"ctty", false},
+		{"working", true},
+		{"done", false},
+		{"eof", false},
+	}
+
+	if !reflect.DeepEqual(want, lines) {
+		t.Errorf("want %v, got %v", want, lines)
+	}
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("running jobs in a pseudo-terminal is only supported on Linux")
+}
+
+func setControllingTerminal(cmd *exec.Cmd) {}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket which limits how often jobs are started. The
+// bucket starts with a single token so that all workers grabbing a job at
+// startup do not cause a burst.
+type rateLimiter struct {
+	m sync.Mutex
+
+	interval time.Duration // time to refill one token
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newRateLimiter returns a rateLimiter which allows n starts per period, with
+// bursts of at most n.
+func newRateLimiter(n int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		interval: period / time.Duration(n),
+		capacity: float64(n),
+		tokens:   1,
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and consumes it. Tokens are reserved
+// in the order Wait is called, so the waiting time grows with the number of
+// concurrent callers.
+func (r *rateLimiter) Wait() {
+	r.m.Lock()
+
+	now := time.Now()
+
+	r.tokens += float64(now.Sub(r.last)) / float64(r.interval)
+	if r.tokens > r.capacity {
+		r.tokens = r.capacity
+	}
+
+	r.last = now
+	r.tokens--
+
+	var wait time.Duration
+	if r.tokens < 0 {
+		wait = time.Duration(-r.tokens * float64(r.interval))
+	}
+
+	r.m.Unlock()
+
+	time.Sleep(wait)
+}
+
+// parseRate parses a rate such as "5/s", "100/m" or "3/10s" into the number
+// of events and the period.
+func parseRate(s string) (int, time.Duration, error) {
+	parts := strings.SplitN(s, "/", 2) //nolint:gomnd
+	if len(parts) != 2 {               //nolint:gomnd
+		return 0, 0, fmt.Errorf("invalid rate %q, expected e.g. 5/s", s)
+	}
+
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid number of starts in rate %q", s)
+	}
+
+	var period time.Duration
+
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		period, err = time.ParseDuration(parts[1])
+		if err != nil || period <= 0 {
+			return 0, 0, fmt.Errorf("invalid period in rate %q", s)
+		}
+	}
+
+	return n, period, nil
+}
+
+// startLimiters delay the start of jobs, they are shared by all workers.
+var startLimiters []*rateLimiter
+
+// waitForStart blocks until all start limiters allow starting the next job.
+func waitForStart() {
+	for _, l := range startLimiters {
+		l.Wait()
+	}
+}
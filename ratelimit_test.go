@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var rateTests = []struct {
+	input  string
+	n      int
+	period time.Duration
+	err    bool
+}{
+	{"5/s", 5, time.Second, false},
+	{"100/m", 100, time.Minute, false},
+	{"2/h", 2, time.Hour, false},
+	{"3/10s", 3, 10 * time.Second, false},
+	{"5", 0, 0, true},
+	{"0/s", 0, 0, true},
+	{"x/s", 0, 0, true},
+	{"5/x", 0, 0, true},
+}
+
+func TestParseRate(t *testing.T) {
+	t.Parallel()
+
+	for i, test := range rateTests {
+		n, period, err := parseRate(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("test %d failed: expected error for %q, got none", i, test.input)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+
+			continue
+		}
+
+		if n != test.n || period != test.period {
+			t.Errorf("test %d failed: want %v/%v, got %v/%v", i, test.n, test.period, n, period)
+		}
+	}
+}
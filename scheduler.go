@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// queuedCommand is a command waiting in the queue of the scheduler.
+type queuedCommand struct {
+	cmd *Command
+
+	// seq is the order in which the commands have been queued
+	seq int
+}
+
+// commandQueue is a priority queue of commands, it implements heap.Interface.
+// Commands with a higher priority come first, commands with the same priority
+// are ordered by the time they were queued.
+type commandQueue []queuedCommand
+
+func (q commandQueue) Len() int { return len(q) }
+
+func (q commandQueue) Less(i, j int) bool {
+	if q[i].cmd.Priority != q[j].cmd.Priority {
+		return q[i].cmd.Priority > q[j].cmd.Priority
+	}
+
+	return q[i].seq < q[j].seq
+}
+
+func (q commandQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commandQueue) Push(x interface{}) { *q = append(*q, x.(queuedCommand)) }
+
+func (q *commandQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return item
+}
+
+// scheduler hands out commands to the workers. Commands are started by
+// priority (see --order) and then in the order they were queued, but a command
+// whose key already has the maximum number of jobs running is skipped until
+// one of them has finished. Since the best runnable command is always chosen
+// from the whole queue, a skipped command is the first one to be started once
+// its key is free again, so it is not starved by commands queued later.
+type scheduler struct {
+	m    sync.Mutex
+	cond *sync.Cond
+
+	pending commandQueue
+	seq     int
+	closed  bool
+
+	// limit is the maximum number of running jobs per key, zero means no limit
+	limit   int
+	running map[string]int
+}
+
+// checkLimit returns an error if the value for --limit is invalid or --limit
+// is used without --limit-by.
+func checkLimit(limitSet bool) error {
+	if opts.limitBy == "" {
+		if limitSet {
+			return errors.New("--limit can only be used with --limit-by")
+		}
+
+		return nil
+	}
+
+	if opts.limit < 1 {
+		return fmt.Errorf("invalid limit %d for --limit-by, must be at least 1", opts.limit)
+	}
+
+	return nil
+}
+
+// newScheduler returns a scheduler which runs at most limit jobs per key.
+func newScheduler(limit int) *scheduler {
+	s := &scheduler{
+		limit:   limit,
+		running: make(map[string]int),
+	}
+	s.cond = sync.NewCond(&s.m)
+
+	return s
+}
+
+// Feed queues all commands received from in until the channel is closed. At
+// most commandBuffer commands are held in the queue.
+func (s *scheduler) Feed(in <-chan *Command) {
+	for cmd := range in {
+		s.m.Lock()
+
+		for len(s.pending) >= commandBuffer {
+			s.cond.Wait()
+		}
+
+		heap.Push(&s.pending, queuedCommand{cmd: cmd, seq: s.seq})
+		s.seq++
+		s.cond.Broadcast()
+
+		s.m.Unlock()
+	}
+
+	s.m.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.m.Unlock()
+}
+
+// allowed returns true if the command may be started now. The mutex must be
+// held by the caller.
+func (s *scheduler) allowed(cmd *Command) bool {
+	return s.limit == 0 || s.running[cmd.Key] < s.limit
+}
+
+// runnable returns the index of the first command in the queue which may be
+// started now, or -1 if there is none. The mutex must be held by the caller.
+func (s *scheduler) runnable() int {
+	if len(s.pending) > 0 && s.allowed(s.pending[0].cmd) {
+		return 0
+	}
+
+	best := -1
+
+	for i, item := range s.pending {
+		if s.allowed(item.cmd) && (best < 0 || s.pending.Less(i, best)) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// Next blocks until a command may be started and returns it. When all commands
+// have been handed out, nil is returned.
+func (s *scheduler) Next() *Command {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for {
+		if i := s.runnable(); i >= 0 {
+			cmd := heap.Remove(&s.pending, i).(queuedCommand).cmd
+			s.running[cmd.Key]++
+			s.cond.Broadcast()
+
+			return cmd
+		}
+
+		if s.closed && len(s.pending) == 0 {
+			return nil
+		}
+
+		s.cond.Wait()
+	}
+}
+
+// Done marks a command returned by Next as finished.
+func (s *scheduler) Done(cmd *Command) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.running[cmd.Key]--
+	if s.running[cmd.Key] == 0 {
+		delete(s.running, cmd.Key)
+	}
+
+	s.cond.Broadcast()
+}
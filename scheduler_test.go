@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSchedulerLimitPerKey(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan *Command, 10)
+	for i, key := range []string{"a", "a", "b", "a", "c"} {
+		ch <- &Command{ID: i + 1, Key: key}
+	}
+	close(ch)
+
+	s := newScheduler(1)
+	s.Feed(ch)
+
+	// the second command for key "a" is skipped
+	var running []*Command
+
+	for _, want := range []int{1, 3, 5} {
+		cmd := s.Next()
+		if cmd.ID != want {
+			t.Fatalf("want command %v, got %v", want, cmd.ID)
+		}
+
+		running = append(running, cmd)
+	}
+
+	// once the first command has finished, the oldest waiting one is next
+	s.Done(running[0])
+
+	if cmd := s.Next(); cmd.ID != 2 {
+		t.Fatalf("want command 2, got %v", cmd.ID)
+	}
+
+	s.Done(running[1])
+	s.Done(running[2])
+
+	if len(s.pending) != 1 {
+		t.Fatalf("want one pending command, got %v", len(s.pending))
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan *Command, 10)
+	for i, prio := range []int{1, 5, 3, 5, 0} {
+		ch <- &Command{ID: i + 1, Priority: prio, Key: "a"}
+	}
+	close(ch)
+
+	s := newScheduler(0)
+	s.Feed(ch)
+
+	// the highest priorities come first, equal priorities in the order queued
+	for _, want := range []int{2, 4, 3, 1, 5} {
+		cmd := s.Next()
+		if cmd.ID != want {
+			t.Fatalf("want command %v, got %v", want, cmd.ID)
+		}
+
+		s.Done(cmd)
+	}
+
+	if cmd := s.Next(); cmd != nil {
+		t.Fatalf("want no more commands, got %v", cmd.ID)
+	}
+}
+
+func TestSchedulerPriorityLimitPerKey(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan *Command, 10)
+	for i, key := range []string{"a", "a", "b", "b"} {
+		ch <- &Command{ID: i + 1, Priority: 10 - i, Key: key}
+	}
+	close(ch)
+
+	s := newScheduler(1)
+	s.Feed(ch)
+
+	// the command with the highest priority for key "b" is started while "a" is busy
+	for _, want := range []int{1, 3} {
+		if cmd := s.Next(); cmd.ID != want {
+			t.Fatalf("want command %v, got %v", want, cmd.ID)
+		}
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	defer func(limitBy string, limit int) {
+		opts.limitBy, opts.limit = limitBy, limit
+	}(opts.limitBy, opts.limit)
+
+	var tests = []struct {
+		limitBy  string
+		limit    int
+		limitSet bool
+		valid    bool
+	}{
+		{"", 1, false, true},
+		{"", 3, true, false},
+		{"{1}", 1, false, true},
+		{"{1}", 3, true, true},
+		{"{1}", 0, true, false},
+		{"{1}", -1, true, false},
+	}
+
+	for i, test := range tests {
+		opts.limitBy = test.limitBy
+		opts.limit = test.limit
+
+		err := checkLimit(test.limitSet)
+		if (err == nil) != test.valid {
+			t.Errorf("test %d failed: want valid %v, got error %v", i, test.valid, err)
+		}
+	}
+}
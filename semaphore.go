@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// semaphorePollInterval is the time between two attempts to get a slot of a
+// semaphore.
+const semaphorePollInterval = 200 * time.Millisecond
+
+// stateDir returns the directory machma keeps state in, which is
+// $XDG_STATE_HOME/machma or ~/.local/state/machma.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "machma"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "state", "machma"), nil
+}
+
+// semaphore limits the number of concurrent jobs across several machma
+// processes. Each slot is a file in the state directory, a slot is taken by
+// holding an exclusive lock on the file. Locks are released by the operating
+// system when a process exits, so slots are not leaked when machma is killed.
+type semaphore struct {
+	dir   string
+	slots int
+}
+
+// openSemaphore returns the semaphore with the given name and number of slots.
+func openSemaphore(name string, slots int) (*semaphore, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid semaphore name %q", name)
+	}
+
+	if slots <= 0 {
+		return nil, errors.New("number of semaphore slots must be positive")
+	}
+
+	err := checkFileLocking()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir = filepath.Join(dir, "semaphores", name)
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &semaphore{dir: dir, slots: slots}, nil
+}
+
+// tryAcquire tries to lock one of the slot files. If all slots are taken, nil
+// is returned.
+func (s *semaphore) tryAcquire() (*os.File, error) {
+	for i := 0; i < s.slots; i++ {
+		f, err := os.OpenFile(filepath.Join(s.dir, fmt.Sprintf("slot-%d", i)), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+
+			return nil, err
+		}
+
+		if ok {
+			return f, nil
+		}
+
+		_ = f.Close()
+	}
+
+	return nil, nil
+}
+
+// Acquire blocks until a slot is available and returns the locked file for
+// the slot, which must be passed to Release afterwards.
+func (s *semaphore) Acquire() (*os.File, error) {
+	for {
+		f, err := s.tryAcquire()
+		if err != nil || f != nil {
+			return f, err
+		}
+
+		// add some jitter so that waiting processes do not poll in lockstep
+		time.Sleep(semaphorePollInterval + time.Duration(rand.Int63n(int64(semaphorePollInterval))))
+	}
+}
+
+// Release frees the slot.
+func (s *semaphore) Release(f *os.File) {
+	_ = unlockFile(f)
+	_ = f.Close()
+}
+
+// globalSemaphore is shared with other machma processes if set.
+var globalSemaphore *semaphore
@@ -0,0 +1,103 @@
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreSerialize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	oldStateHome := os.Getenv("XDG_STATE_HOME")
+	defer os.Setenv("XDG_STATE_HOME", oldStateHome)
+
+	err = os.Setenv("XDG_STATE_HOME", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two instances stand in for two machma processes, flock locks belong to
+	// the open file, so they also conflict within one process
+	sem1, err := openSemaphore("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sem2, err := openSemaphore("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot1, err := sem1.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot2, err := sem2.tryAcquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot2 != nil {
+		sem2.Release(slot2)
+		t.Fatalf("second instance acquired the slot held by the first one")
+	}
+
+	acquired := make(chan error, 1)
+
+	go func() {
+		slot, err := sem2.Acquire()
+		if err == nil {
+			sem2.Release(slot)
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("second instance acquired the slot before it was released: %v", err)
+	case <-time.After(3 * semaphorePollInterval):
+	}
+
+	sem1.Release(slot1)
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * semaphorePollInterval):
+		t.Fatalf("second instance did not acquire the released slot")
+	}
+}
+
+func TestSemaphoreInvalid(t *testing.T) {
+	var tests = []struct {
+		name  string
+		slots int
+	}{
+		{"", 1},
+		{".", 1},
+		{"..", 1},
+		{"foo/bar", 1},
+		{`foo\bar`, 1},
+		{"foo", 0},
+		{"foo", -1},
+	}
+
+	for i, test := range tests {
+		_, err := openSemaphore(test.name, test.slots)
+		if err == nil {
+			t.Errorf("test %d failed: want error for name %q and %d slots, got nil", i, test.name, test.slots)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// checkFileLocking returns an error if the locks needed for semaphores are not
+// supported.
+func checkFileLocking() error {
+	return errors.New("semaphores are not supported on Windows")
+}
+
+func tryLockFile(f *os.File) (bool, error) {
+	return false, errors.New("semaphores are not supported on Windows")
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Settings which must be in place before the command of a job runs (like the
+// cgroup or the priorities) cannot be applied by machma after starting the
+// process, children the command starts right away would escape them. So
+// machma starts itself as a shim instead:
+//
+//	machma --machma-exec-shim cgroup=<dir> nice=10 cpu=3 -- <path> <argv...>
+//
+// The shim applies the settings to its own process and then executes the
+// command in its place.
+
+// shimArg is the first argument when machma is started as the shim.
+const shimArg = "--machma-exec-shim"
+
+// Exit codes of the shim if a setting could not be applied or executing the
+// command failed.
+const (
+	exitShimFailed     = 126
+	exitShimExecFailed = 127
+)
+
+// shimExecutable is the machma binary started as the shim, it is set when any
+// job needs the shim.
+var shimExecutable string
+
+// needShim returns true if the jobs must be started via the shim.
+func needShim() bool {
+	return cgroups != nil || opts.nice != 0 || jobIOPriority.class != ioClassNone || opts.pinCPUs
+}
+
+// shimSettings returns the settings the shim applies for the job.
+func (c *Command) shimSettings() []string {
+	var settings []string
+
+	if c.cgroup != nil {
+		settings = append(settings, "cgroup="+c.cgroup.Path())
+	}
+
+	if opts.nice != 0 {
+		settings = append(settings, "nice="+strconv.Itoa(opts.nice))
+	}
+
+	if jobIOPriority.class != ioClassNone {
+		settings = append(settings, "ionice="+opts.ioniceClass)
+	}
+
+	if opts.pinCPUs {
+		settings = append(settings, "cpu="+strconv.Itoa(c.Slot))
+	}
+
+	return settings
+}
+
+// command returns the process to start for the job.
+func (c *Command) command() *exec.Cmd {
+	settings := c.shimSettings()
+	if len(settings) == 0 {
+		return exec.Command(c.Cmd, c.Args...) //nolint:gosec
+	}
+
+	path, err := exec.LookPath(c.Cmd)
+	if err != nil {
+		// starting the command directly fails with the same error
+		return exec.Command(c.Cmd, c.Args...) //nolint:gosec
+	}
+
+	args := append([]string{shimArg}, settings...)
+	args = append(args, "--", path, c.Cmd)
+	args = append(args, c.Args...)
+
+	return exec.Command(shimExecutable, args...) //nolint:gosec
+}
+
+// checkShim runs the shim once with the settings for the first worker and
+// without a command, so that settings which cannot be applied (e.g. a negative
+// nice value without the permission) are reported before any job is started.
+func checkShim() error {
+	c := &Command{}
+
+	if cgroups != nil {
+		g, err := cgroups.Create(0)
+		if err != nil {
+			return fmt.Errorf("cgroup: %w", err)
+		}
+
+		defer g.Remove()
+
+		c.cgroup = g
+	}
+
+	args := append([]string{shimArg}, c.shimSettings()...)
+	args = append(args, "--")
+
+	cmd := exec.Command(shimExecutable, args...) //nolint:gosec
+	createProcessGroup(cmd)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimPrefix(strings.TrimSpace(string(out)), "machma: ")
+		if msg == "" {
+			return err
+		}
+
+		return errors.New(msg)
+	}
+
+	return nil
+}
+
+// runShim applies the settings given in args to the current process and then
+// executes the command. Without a command, it only checks the settings.
+// Otherwise it only returns if something went wrong.
+func runShim(args []string) int {
+	sep := -1
+
+	for i, arg := range args {
+		if arg == "--" {
+			sep = i
+
+			break
+		}
+	}
+
+	if sep < 0 || len(args) == sep+2 {
+		fmt.Fprintf(os.Stderr, "machma: invalid arguments for %v\n", shimArg)
+
+		return exitShimFailed
+	}
+
+	for _, setting := range args[:sep] {
+		err := applyShimSetting(setting)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "machma: %v\n", err)
+
+			return exitShimFailed
+		}
+	}
+
+	if len(args) == sep+1 {
+		return 0
+	}
+
+	err := execCommand(args[sep+1], args[sep+2:])
+	fmt.Fprintf(os.Stderr, "machma: %v\n", err)
+
+	return exitShimExecFailed
+}
+
+// applyShimSetting applies a single setting like "cgroup=<dir>".
+func applyShimSetting(setting string) error {
+	i := strings.IndexByte(setting, '=')
+	if i < 0 {
+		return fmt.Errorf("invalid setting %q", setting)
+	}
+
+	key, value := setting[:i], setting[i+1:]
+
+	switch key {
+	case "cgroup":
+		err := joinCgroup(value)
+		if err != nil {
+			return fmt.Errorf("cgroup: %w", err)
+		}
+
+		return nil
+	case "nice":
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			err = setNice(os.Getpid(), n)
+		}
+
+		if err != nil {
+			return fmt.Errorf("nice: %w", err)
+		}
+
+		return nil
+	case "ionice":
+		prio, err := parseIOPriority(value)
+		if err == nil {
+			err = setIOPriority(os.Getpid(), prio)
+		}
+
+		if err != nil {
+			return fmt.Errorf("ionice: %w", err)
+		}
+
+		return nil
+	case "cpu":
+		slot, err := strconv.Atoi(value)
+		if err == nil {
+			err = pinCPU(os.Getpid(), slot)
+		}
+
+		if err != nil {
+			return fmt.Errorf("pin CPU: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown setting %q", setting)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShimSettings(t *testing.T) {
+	defer func(nice int, ionice string, pin bool, prio ioPriority) {
+		opts.nice, opts.ioniceClass, opts.pinCPUs, jobIOPriority = nice, ionice, pin, prio
+	}(opts.nice, opts.ioniceClass, opts.pinCPUs, jobIOPriority)
+
+	var tests = []struct {
+		nice     int
+		ionice   string
+		pin      bool
+		slot     int
+		settings []string
+	}{
+		{0, "", false, 0, nil},
+		{10, "", false, 0, []string{"nice=10"}},
+		{0, "best-effort:7", false, 0, []string{"ionice=best-effort:7"}},
+		{0, "", true, 3, []string{"cpu=3"}},
+		{-5, "idle", true, 1, []string{"nice=-5", "ionice=idle", "cpu=1"}},
+	}
+
+	for i, test := range tests {
+		var err error
+
+		opts.nice, opts.ioniceClass, opts.pinCPUs = test.nice, test.ionice, test.pin
+
+		jobIOPriority, err = parseIOPriority(test.ionice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &Command{Slot: test.slot}
+
+		settings := c.shimSettings()
+		if !reflect.DeepEqual(settings, test.settings) {
+			t.Errorf("test %d failed: want %q, got %q", i, test.settings, settings)
+		}
+	}
+}
+
+func TestRunShimArgs(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		args []string
+		code int
+	}{
+		{[]string{}, exitShimFailed},
+		{[]string{"--"}, 0},
+		{[]string{"--", "/bin/true"}, exitShimFailed},
+		{[]string{"foo", "--"}, exitShimFailed},
+		{[]string{"foo=bar", "--"}, exitShimFailed},
+		{[]string{"nice=x", "--"}, exitShimFailed},
+		{[]string{"cpu=x", "--"}, exitShimFailed},
+	}
+
+	for i, test := range tests {
+		code := runShim(test.args)
+		if code != test.code {
+			t.Errorf("test %d failed: want %v, got %v", i, test.code, code)
+		}
+	}
+}
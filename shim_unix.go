@@ -0,0 +1,13 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// execCommand replaces the current process with the program at path.
+func execCommand(path string, argv []string) error {
+	return syscall.Exec(path, argv, os.Environ())
+}
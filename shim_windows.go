@@ -0,0 +1,9 @@
+package main
+
+import (
+	"errors"
+)
+
+func execCommand(path string, argv []string) error {
+	return errors.New("executing a program in place of machma is not supported on Windows")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+)
+
+// successCodes contains the exit codes which are not considered a failure.
+var successCodes = map[int]bool{0: true}
+
+// failOnOutput marks a job as failed if it prints a matching line.
+var failOnOutput *regexp.Regexp
+
+// checkOutput records if a line printed by the command marks the job as
+// failed.
+func (c *Command) checkOutput(line string, isError bool) {
+	var reason string
+
+	switch {
+	case isError && opts.failOnStderr:
+		reason = "printed to stderr"
+	case failOnOutput != nil && failOnOutput.MatchString(line):
+		reason = fmt.Sprintf("output matched %q", failOnOutput)
+	default:
+		return
+	}
+
+	c.m.Lock()
+	if c.outputFailure == "" {
+		c.outputFailure = reason
+	}
+	c.m.Unlock()
+}
+
+// checkSuccess decides whether a command has failed, based on the error
+// returned by Run, the configured exit codes and the output of the command.
+func (c *Command) checkSuccess(err error) error {
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil && !successCodes[0]:
+		err = errors.New("exit status 0")
+	case errors.As(err, &exitErr) && successCodes[exitErr.ExitCode()]:
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.outputFailure != "" {
+		return errors.New(c.outputFailure)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseSuccessOptions(t *testing.T) {
+	defer func(codes []int, pattern string, codeMap map[int]bool, re *regexp.Regexp, drainTimeout time.Duration) {
+		opts.successCodes, opts.failOnOutput, successCodes, failOnOutput = codes, pattern, codeMap, re
+		opts.drainTimeout = drainTimeout
+	}(opts.successCodes, opts.failOnOutput, successCodes, failOnOutput, opts.drainTimeout)
+
+	opts.drainTimeout = 2 * time.Second
+
+	var tests = []struct {
+		codes   []int
+		pattern string
+		want    map[int]bool
+		err     bool
+	}{
+		{[]int{0}, "", map[int]bool{0: true}, false},
+		{[]int{0, 1, 24}, "", map[int]bool{0: true, 1: true, 24: true}, false},
+		{[]int{1}, "", map[int]bool{1: true}, false},
+		{[]int{0}, "^ERROR", map[int]bool{0: true}, false},
+		{[]int{0}, "(", nil, true},
+	}
+
+	for i, test := range tests {
+		opts.successCodes = test.codes
+		opts.failOnOutput = test.pattern
+		failOnOutput = nil
+
+		err := parseJobOptions()
+		if test.err != (err != nil) {
+			t.Errorf("test %d failed: unexpected error value %v", i, err)
+
+			continue
+		}
+
+		if test.err {
+			continue
+		}
+
+		if !reflect.DeepEqual(test.want, successCodes) {
+			t.Errorf("test %d failed: want %v, got %v", i, test.want, successCodes)
+		}
+
+		if (test.pattern != "") != (failOnOutput != nil) {
+			t.Errorf("test %d failed: want pattern %q, got %v", i, test.pattern, failOnOutput)
+		}
+	}
+}
+
+type outputLine struct {
+	text    string
+	isError bool
+}
+
+func TestCheckSuccess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	defer func(codeMap map[int]bool, re *regexp.Regexp, stderr bool) {
+		successCodes, failOnOutput, opts.failOnStderr = codeMap, re, stderr
+	}(successCodes, failOnOutput, opts.failOnStderr)
+
+	var tests = []struct {
+		exitCode     int
+		successCodes map[int]bool
+		failOnOutput string
+		failOnStderr bool
+		output       []outputLine
+		err          string
+	}{
+		{0, map[int]bool{0: true}, "", false, nil, ""},
+		{3, map[int]bool{0: true}, "", false, nil, "exit status 3"},
+		{3, map[int]bool{0: true, 3: true}, "", false, nil, ""},
+		{0, map[int]bool{1: true}, "", false, nil, "exit status 0"},
+		{0, map[int]bool{0: true}, "^ERROR", false,
+			[]outputLine{{"working", false}, {"ERROR: disk full", false}},
+			`output matched "^ERROR"`},
+		{0, map[int]bool{0: true}, "^ERROR", false,
+			[]outputLine{{"no ERROR here", false}}, ""},
+		{0, map[int]bool{0: true}, "", true,
+			[]outputLine{{"working", false}, {"warning", true}},
+			"printed to stderr"},
+		{0, map[int]bool{0: true}, "", false,
+			[]outputLine{{"warning", true}}, ""},
+		// the exit code takes precedence over the output
+		{2, map[int]bool{0: true}, "", true,
+			[]outputLine{{"warning", true}}, "exit status 2"},
+		// the first reason is reported
+		{0, map[int]bool{0: true}, "fail", true,
+			[]outputLine{{"fail", false}, {"warning", true}},
+			`output matched "fail"`},
+	}
+
+	for i, test := range tests {
+		successCodes = test.successCodes
+		opts.failOnStderr = test.failOnStderr
+
+		failOnOutput = nil
+		if test.failOnOutput != "" {
+			failOnOutput = regexp.MustCompile(test.failOnOutput)
+		}
+
+		c := &Command{}
+		for _, line := range test.output {
+			c.checkOutput(line.text, line.isError)
+		}
+
+		runErr := exec.Command("sh", "-c", fmt.Sprintf("exit %d", test.exitCode)).Run()
+
+		var msg string
+		if err := c.checkSuccess(runErr); err != nil {
+			msg = err.Error()
+		}
+
+		if msg != test.err {
+			t.Errorf("test %d failed: want error %q, got %q", i, test.err, msg)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// terminalWidth returns the number of columns of the console on stdout, or
+// zero if it cannot be determined.
+func terminalWidth() int {
+	var info windows.ConsoleScreenBufferInfo
+
+	err := windows.GetConsoleScreenBufferInfo(windows.Handle(os.Stdout.Fd()), &info)
+	if err != nil {
+		return 0
+	}
+
+	return int(info.Window.Right-info.Window.Left) + 1
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timeoutPattern sets the timeout for all items matching a glob pattern.
+type timeoutPattern struct {
+	pattern string
+	timeout time.Duration
+}
+
+// parseTimeoutPatterns parses a list of patterns like "*.mkv=2h".
+func parseTimeoutPatterns(list []string) ([]timeoutPattern, error) {
+	patterns := make([]timeoutPattern, 0, len(list))
+
+	for _, s := range list {
+		i := strings.LastIndexByte(s, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid timeout pattern %q, expected e.g. '*.mkv=2h'", s)
+		}
+
+		_, err := filepath.Match(s[:i], "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in %q: %w", s, err)
+		}
+
+		d, err := time.ParseDuration(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout in %q: %w", s, err)
+		}
+
+		patterns = append(patterns, timeoutPattern{pattern: s[:i], timeout: d})
+	}
+
+	return patterns, nil
+}
+
+// timeoutPatterns are checked in order for each item.
+var timeoutPatterns []timeoutPattern
+
+// itemTimeout returns the timeout for an item, either taken from the item
+// itself (via --timeout-from) or from the first matching pattern. If neither
+// is set, zero is returned.
+func itemTimeout(item string, fields []string) (time.Duration, error) {
+	if opts.timeoutFrom != "" {
+		s := expandTemplate(opts.timeoutFrom, item, fields)
+		if s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return 0, fmt.Errorf("invalid timeout %q", s)
+			}
+
+			return d, nil
+		}
+	}
+
+	for _, p := range timeoutPatterns {
+		if ok, _ := filepath.Match(p.pattern, item); ok {
+			return p.timeout, nil
+		}
+
+		// patterns without a slash also match the last element of a path
+		if ok, _ := filepath.Match(p.pattern, filepath.Base(item)); ok && !strings.Contains(p.pattern, "/") {
+			return p.timeout, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// timeoutFactorMinJobs is the number of finished jobs needed before the
+// timeout derived from the median duration is applied.
+const timeoutFactorMinJobs = 3
+
+// relativeTimeout returns the timeout derived from the median duration of the
+// jobs finished so far, or zero if it is not known yet.
+func relativeTimeout() time.Duration {
+	median, n := jobDurations.Median()
+	if n < timeoutFactorMinJobs {
+		return 0
+	}
+
+	d := time.Duration(opts.timeoutFactor * float64(median))
+	if d < opts.timeoutMin {
+		d = opts.timeoutMin
+	}
+
+	return d
+}
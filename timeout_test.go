@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestItemTimeout(t *testing.T) {
+	var err error
+
+	opts.placeholder = "{}"
+
+	timeoutPatterns, err = parseTimeoutPatterns([]string{"*.mkv=2h", "small/*=10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		item    string
+		timeout time.Duration
+	}{
+		{"movie.mkv", 2 * time.Hour},
+		{"videos/movie.mkv", 2 * time.Hour},
+		{"small/foo.txt", 10 * time.Second},
+		{"other/small/foo.txt", 0},
+		{"foo.txt", 0},
+	}
+
+	for i, test := range tests {
+		d, err := itemTimeout(test.item, nil)
+		if err != nil {
+			t.Errorf("test %d failed: unexpected error %v", i, err)
+
+			continue
+		}
+
+		if d != test.timeout {
+			t.Errorf("test %d failed: want %v, got %v", i, test.timeout, d)
+		}
+	}
+
+	_, err = parseTimeoutPatterns([]string{"*.mkv"})
+	if err == nil {
+		t.Errorf("expected error for pattern without timeout, got none")
+	}
+}
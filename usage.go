@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Usage contains the resources used by a job.
+type Usage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	// MaxRSS is the maximum resident set size in bytes
+	MaxRSS int64
+
+	// InBlock and OutBlock are the number of block I/O operations
+	InBlock  int64
+	OutBlock int64
+}
+
+// CPUTime returns the total CPU time used.
+func (u *Usage) CPUTime() time.Duration {
+	return u.UserTime + u.SystemTime
+}
+
+func (u *Usage) String() string {
+	s := fmt.Sprintf("user %.2fs, sys %.2fs", u.UserTime.Seconds(), u.SystemTime.Seconds())
+
+	if u.MaxRSS > 0 {
+		s += fmt.Sprintf(", maxrss %s, io %d/%d", formatBytes(u.MaxRSS), u.InBlock, u.OutBlock)
+	}
+
+	return s
+}
+
+// processUsage returns the resource usage of an exited process.
+func processUsage(state *os.ProcessState) *Usage {
+	if state == nil {
+		return nil
+	}
+
+	u := &Usage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+
+	addSysUsage(u, state)
+
+	return u
+}
+
+//nolint:gomnd
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// usageTopItems is the number of items with the most CPU time shown in the
+// summary.
+const usageTopItems = 5
+
+type taggedUsage struct {
+	tag   string
+	usage *Usage
+}
+
+// usageSummary collects the resource usage of all jobs.
+type usageSummary struct {
+	user, system time.Duration
+
+	top    []taggedUsage
+	maxRSS taggedUsage
+}
+
+// Add records the resource usage of a job.
+func (s *usageSummary) Add(tag string, u *Usage) {
+	s.user += u.UserTime
+	s.system += u.SystemTime
+
+	if s.maxRSS.usage == nil || u.MaxRSS > s.maxRSS.usage.MaxRSS {
+		s.maxRSS = taggedUsage{tag, u}
+	}
+
+	i := sort.Search(len(s.top), func(i int) bool {
+		return s.top[i].usage.CPUTime() < u.CPUTime()
+	})
+
+	if i >= usageTopItems {
+		return
+	}
+
+	s.top = append(s.top, taggedUsage{})
+	copy(s.top[i+1:], s.top[i:])
+	s.top[i] = taggedUsage{tag, u}
+
+	if len(s.top) > usageTopItems {
+		s.top = s.top[:usageTopItems]
+	}
+}
+
+// Print writes the summary to w.
+func (s *usageSummary) Print(w io.Writer) {
+	if len(s.top) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "cpu time: user %.2fs, system %.2fs\n", s.user.Seconds(), s.system.Seconds())
+	fmt.Fprintf(w, "most cpu time:\n")
+
+	for _, item := range s.top {
+		fmt.Fprintf(w, "  %v %.2fs\n", colorTag(item.tag), item.usage.CPUTime().Seconds())
+	}
+
+	if s.maxRSS.usage.MaxRSS > 0 {
+		fmt.Fprintf(w, "highest max rss: %v %s\n", colorTag(s.maxRSS.tag), formatBytes(s.maxRSS.usage.MaxRSS))
+	}
+}
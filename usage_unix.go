@@ -0,0 +1,26 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// addSysUsage adds the system-specific resource usage of the process to u.
+func addSysUsage(u *Usage, state *os.ProcessState) {
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+
+	// ru_maxrss is reported in bytes on macOS and in kilobytes everywhere else
+	u.MaxRSS = int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		u.MaxRSS *= 1024
+	}
+
+	u.InBlock = int64(ru.Inblock)
+	u.OutBlock = int64(ru.Oublock)
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+)
+
+// addSysUsage adds the system-specific resource usage of the process to u.
+func addSysUsage(u *Usage, state *os.ProcessState) {
+	// only the CPU times are available on Windows
+}
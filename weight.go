@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// checkWeightBy returns an error if the value for --weight-by is invalid.
+func checkWeightBy(s string) error {
+	if s == "" || s == "size" || fieldPlaceholder.MatchString(s) || strings.Contains(s, opts.placeholder) {
+		return nil
+	}
+
+	return errors.New("--weight-by must be \"size\" or contain a placeholder, e.g. {2}")
+}
+
+// itemWeight returns the amount of work for an item used for the ETA. Without
+// --weight-by, all items have the weight 1. Otherwise the weight is the size
+// of the file named by the item, or the number taken from the item with a
+// template like {2}.
+func itemWeight(item string, fields []string) (float64, error) {
+	switch opts.weightBy {
+	case "":
+		return 1, nil
+	case "size":
+		fi, err := os.Stat(item)
+		if err != nil {
+			return 0, err
+		}
+
+		return float64(fi.Size()), nil
+	}
+
+	s := expandTemplate(opts.weightBy, item, fields)
+
+	weight, err := strconv.ParseFloat(s, 64)
+	if err != nil || weight < 0 {
+		return 0, fmt.Errorf("invalid weight %q", s)
+	}
+
+	return weight, nil
+}
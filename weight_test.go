@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestItemWeight(t *testing.T) {
+	opts.placeholder = "{}"
+
+	defer func() {
+		opts.weightBy = ""
+	}()
+
+	dir, err := ioutil.TempDir("", "machma-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+
+	err = ioutil.WriteFile(file, make([]byte, 1234), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		weightBy string
+		item     string
+		weight   float64
+		err      bool
+	}{
+		{"", "foo", 1, false},
+		{"size", file, 1234, false},
+		{"size", filepath.Join(dir, "missing"), 0, true},
+		{"{2}", "foo 23.5", 23.5, false},
+		{"{2}", "foo bar", 0, true},
+		{"{2}", "foo -1", 0, true},
+	}
+
+	for i, test := range tests {
+		opts.weightBy = test.weightBy
+
+		weight, err := itemWeight(test.item, strings.Fields(test.item))
+		if (err != nil) != test.err {
+			t.Errorf("test %d failed: want error %v, got %v", i, test.err, err)
+
+			continue
+		}
+
+		if weight != test.weight {
+			t.Errorf("test %d failed: want %v, got %v", i, test.weight, weight)
+		}
+	}
+}
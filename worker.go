@@ -3,9 +3,15 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
 )
 
 // Command collects all information of one invocation of a command.
@@ -15,105 +21,563 @@ type Command struct {
 
 	ID  int
 	Tag string
+
+	// Key is used to limit the number of concurrent jobs for similar items
+	Key string
+
+	// Slot is the number of the worker running the command
+	Slot int
+
+	// Timeout overrides the global timeout for this command if set
+	Timeout time.Duration
+
+	// Weight is the amount of work for the item used for the ETA
+	Weight float64
+
+	// Priority orders the commands in the scheduler, higher first. It is set
+	// with --order, so that the sorted order is kept.
+	Priority int
+
+	// cgroup limits the resources of the process if set
+	cgroup *jobCgroup
+
+	// state is set after the process has exited
+	state *os.ProcessState
+
+	m sync.Mutex
+
+	// lastActivity is the time the process was started or last printed a line
+	lastActivity time.Time
+
+	// idleKilled is set when the process was killed for not printing anything
+	idleKilled bool
+
+	// slowKilled is set to the timeout when the process was killed for
+	// running much longer than the other jobs
+	slowKilled time.Duration
+
+	// outputFailure is the reason why the job failed because of its output
+	outputFailure string
+
+	// startFailed is set when the process could not be started
+	startFailed bool
+
+	// outputMu protects detached, it is held while a line of output is
+	// passed on
+	outputMu sync.Mutex
+
+	// detached is set when the output is not passed on any more because the
+	// job has finished
+	detached bool
+}
+
+// Result describes how a job has finished.
+type Result struct {
+	Start    time.Time
+	Duration time.Duration
+
+	// Usage is nil if the process could not be started
+	Usage *Usage
+
+	// ExitCode is the exit code of the process, or -1 if it did not exit
+	// normally or could not be started
+	ExitCode int
+
+	// Signal is the name of the signal which terminated the process
+	Signal string
+
+	// StartFailed is true if the process could not be started, e.g. because
+	// the program was not found
+	StartFailed bool
+
+	// TimedOut is true if the process was killed because of a timeout or the
+	// deadline
+	TimedOut bool
+
+	// OOMKilled is true if the job reached the memory limit of its cgroup
+	OOMKilled bool
 }
 
 // Run executes the command.
 func (c *Command) Run(ctx context.Context, outCh chan<- Status) error {
-	cmd := exec.Command(c.Cmd, c.Args...) //nolint:gosec
+	cmd := c.command()
 
 	// make sure the new process and all children get a new process group ID
 	createProcessGroup(cmd)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// done is closed when the process has exited
 	done := make(chan struct{})
 
 	// wg tracks all goroutines started
 	var wg sync.WaitGroup
 
-	// start a goroutine which kills the process group when the context is cancelled
-	wg.Add(1)
+	outputs, closeAfterStart, err := c.openOutputs(cmd)
+	if err != nil {
+		return err
+	}
+
+	// outputWg tracks the goroutines reading the output of the process
+	var outputWg sync.WaitGroup
 
-	go func() {
+	for _, output := range outputs {
+		outputWg.Add(1)
+		go c.tagLines(&outputWg, output.isError, output.f, outCh) //nolint:wsl
+	}
+
+	c.activity()
+
+	err = cmd.Start()
+
+	// close our copies of the write ends, so that reading returns EOF when the
+	// process has exited
+	for _, f := range closeAfterStart {
+		_ = f.Close()
+	}
+
+	if err != nil {
+		c.startFailed = true
+	} else {
+		// start a goroutine which kills the process group when the context is cancelled
+		wg.Add(1)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = killProcessGroup(cmd)
+			case <-done:
+			}
+			wg.Done()
+		}()
+
+		if opts.idleTimeout > 0 {
+			wg.Add(1)
+			go c.watchIdle(&wg, done, cancel, opts.idleTimeout) //nolint:wsl
+		}
+
+		if opts.timeoutFactor > 0 {
+			wg.Add(1)
+			go c.watchDuration(&wg, done, cancel) //nolint:wsl
+		}
+
+		err = cmd.Wait()
+	}
+
+	c.state = cmd.ProcessState
+
+	close(done)
+	wg.Wait()
+
+	c.drainOutputs(&outputWg, outputs)
+
+	c.m.Lock()
+	if c.idleKilled && err != nil {
+		err = fmt.Errorf("killed after %v without output", opts.idleTimeout)
+	}
+
+	if c.slowKilled > 0 && err != nil {
+		err = fmt.Errorf("killed after %v, %vx the median duration", c.slowKilled, opts.timeoutFactor)
+	}
+	c.m.Unlock()
+
+	return err
+}
+
+// durationCheckInterval is the interval in which the runtime of a job is
+// compared to the timeout derived from the median duration.
+const durationCheckInterval = 250 * time.Millisecond
+
+// watchDuration cancels the process when it runs longer than the timeout
+// derived from the durations of the other jobs. Since the timeout changes
+// while jobs finish, it is checked periodically.
+func (c *Command) watchDuration(wg *sync.WaitGroup, done <-chan struct{}, cancel context.CancelFunc) {
+	defer wg.Done()
+
+	start := time.Now()
+
+	ticker := time.NewTicker(durationCheckInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
-		case <-ctx.Done():
-			_ = killProcessGroup(cmd)
 		case <-done:
+			return
+		case <-ticker.C:
 		}
-		wg.Done()
-	}()
 
-	stdout, err := cmd.StdoutPipe()
+		timeout := relativeTimeout()
+		if timeout > 0 && time.Since(start) > timeout {
+			c.m.Lock()
+			c.slowKilled = timeout.Round(time.Millisecond)
+			c.m.Unlock()
+			cancel()
+
+			return
+		}
+	}
+}
+
+// activity records that the process has just printed something.
+func (c *Command) activity() {
+	c.m.Lock()
+	c.lastActivity = time.Now()
+	c.m.Unlock()
+}
+
+// watchIdle cancels the process when it has not printed anything for the
+// timeout.
+func (c *Command) watchIdle(wg *sync.WaitGroup, done <-chan struct{}, cancel context.CancelFunc, timeout time.Duration) {
+	defer wg.Done()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		c.m.Lock()
+		idle := time.Since(c.lastActivity)
+
+		if idle >= timeout {
+			c.idleKilled = true
+			c.m.Unlock()
+			cancel()
+
+			return
+		}
+		c.m.Unlock()
+
+		timer.Reset(timeout - idle)
+	}
+}
+
+// output is a file the output of the process is read from.
+type output struct {
+	f       *os.File
+	isError bool
+}
+
+// openOutputs connects stdout and stderr of the process to pipes, or to a
+// pseudo-terminal if requested. It returns the files to read the output from,
+// and the files which must be closed after the process has been started.
+func (c *Command) openOutputs(cmd *exec.Cmd) (outputs []output, closeAfterStart []*os.File, err error) {
+	if opts.pty {
+		master, slave, err := openPTY()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// stdin is left at /dev/null like without a pseudo-terminal, so that
+		// programs reading from the terminal get EOF instead of hanging
+		setControllingTerminal(cmd)
+		cmd.Stdout, cmd.Stderr = slave, slave
+
+		return []output{{f: master}}, []*os.File{slave}, nil
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	stderr, err := cmd.StderrPipe()
+	stderrR, stderrW, err := os.Pipe()
 	if err != nil {
-		return err
+		_ = stdoutR.Close()
+		_ = stdoutW.Close()
+
+		return nil, nil, err
 	}
 
-	wg.Add(1)
-	go c.tagLines(&wg, false, stdout, outCh) //nolint:wsl
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+
+	return []output{{f: stdoutR}, {f: stderrR, isError: true}}, []*os.File{stdoutW, stderrW}, nil
+}
 
-	wg.Add(1)
-	go c.tagLines(&wg, true, stderr, outCh) //nolint:wsl
+// drainOutputs waits until all output of the process has been read, and closes
+// the files afterwards. Children started in the background may keep the output
+// open much longer than the process runs, after --output-drain-timeout their
+// output is detached: it is still read (so that they neither block nor get
+// SIGPIPE), but not passed on any more.
+func (c *Command) drainOutputs(wg *sync.WaitGroup, outputs []output) {
+	drained := make(chan struct{})
 
-	err = cmd.Run()
+	go func() {
+		wg.Wait()
 
-	close(done)
-	wg.Wait()
+		for _, output := range outputs {
+			_ = output.f.Close()
+		}
 
-	return err
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(opts.drainTimeout):
+		c.outputMu.Lock()
+		c.detached = true
+		c.outputMu.Unlock()
+	}
+}
+
+// send passes a status for the output on, unless the output has been detached.
+func (c *Command) send(out chan<- Status, s Status) bool {
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+
+	if c.detached {
+		return false
+	}
+
+	out <- s
+
+	return true
 }
 
 func (c *Command) tagLines(wg *sync.WaitGroup, isError bool, input io.Reader, out chan<- Status) {
 	defer wg.Done()
 
+	// keep reading so that the process does not block when writing, also
+	// after reading failed or the output has been detached
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, input)
+	}()
+
+	// progress is the last progress message, it is logged if it is followed
+	// by a line break
+	var progress string
+
+	var splitter lineSplitter
+
 	sc := bufio.NewScanner(input)
+	sc.Split(splitter.Split)
+
 	for sc.Scan() {
-		out <- Status{
+		c.activity()
+
+		token := sc.Bytes()
+		line := sanitize(string(trimLineEnd(token)), true)
+
+		if isProgress(token) {
+			if line != "" {
+				progress = line
+
+				ok := c.send(out, Status{
+					Error:    isError,
+					Tag:      c.Tag,
+					ID:       c.ID,
+					Message:  line,
+					Progress: true,
+				})
+				if !ok {
+					return
+				}
+			}
+
+			continue
+		}
+
+		if line == "" {
+			line = progress
+		}
+
+		progress = ""
+
+		c.checkOutput(sanitize(line, false), isError)
+
+		ok := c.send(out, Status{
 			Error:   isError,
 			Tag:     c.Tag,
 			ID:      c.ID,
-			Message: sc.Text(),
+			Message: line,
+		})
+		if !ok {
+			return
 		}
 	}
+
+	err := sc.Err()
+	if err == nil || isEndOfOutput(err) {
+		return
+	}
+
+	c.send(out, Status{
+		Error:   true,
+		Tag:     c.Tag,
+		ID:      c.ID,
+		Message: fmt.Sprintf("warning: reading output failed: %v", err),
+	})
 }
 
-func worker(wg *sync.WaitGroup, in <-chan *Command, outCh chan<- Status) {
-	defer wg.Done()
+// isEndOfOutput returns true for errors which just mean that there is no more
+// output: the process has exited and the pseudo-terminal returns EIO.
+func isEndOfOutput(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
+
+// skippedStatus returns the final status for a job which was never started.
+func skippedStatus(cmd *Command) Status {
+	return Status{
+		Tag:     cmd.Tag,
+		ID:      cmd.ID,
+		Done:    true,
+		Skipped: true,
+	}
+}
+
+// runJob runs a single command and returns the final status for it.
+func runJob(ctx context.Context, cmd *Command, outCh chan<- Status) Status {
+	if beyondDeadline() {
+		return skippedStatus(cmd)
+	}
+
+	var err error
+
+	if globalSemaphore != nil {
+		var slot *os.File
 
-	for cmd := range in {
-		outCh <- Status{
-			Tag:   cmd.Tag,
-			ID:    cmd.ID,
-			Start: true,
+		slot, err = globalSemaphore.Acquire()
+		if err != nil {
+			err = fmt.Errorf("semaphore: %w", err)
+		} else {
+			defer globalSemaphore.Release(slot)
 		}
+	}
+
+	waitForStart()
 
-		ctx := context.Background()
+	// check again, waiting for the start may have taken some time
+	if beyondDeadline() {
+		return skippedStatus(cmd)
+	}
+
+	outCh <- Status{
+		Tag:    cmd.Tag,
+		ID:     cmd.ID,
+		Start:  true,
+		Weight: cmd.Weight,
+		Slot:   cmd.Slot,
+	}
 
+	timeout := opts.workerTimeout
+	if cmd.Timeout > 0 {
+		timeout = cmd.Timeout
+	}
+
+	if timeout > 0 {
 		var cancel context.CancelFunc
 
-		if opts.workerTimeout > 0 {
-			ctx, cancel = context.WithTimeout(context.Background(), opts.workerTimeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err == nil && cgroups != nil {
+		cmd.cgroup, err = cgroups.Create(cmd.ID)
+		if err != nil {
+			err = fmt.Errorf("cgroup: %w", err)
 		}
+	}
+
+	start := time.Now()
+
+	if err == nil {
+		err = cmd.checkSuccess(cmd.Run(ctx, outCh))
+	}
 
-		err := cmd.Run(ctx, outCh)
-		finalStatus := Status{
-			Tag:  cmd.Tag,
-			ID:   cmd.ID,
-			Done: true,
+	res := &Result{
+		Start:       start,
+		Duration:    time.Since(start),
+		Usage:       processUsage(cmd.state),
+		ExitCode:    -1,
+		StartFailed: cmd.startFailed,
+	}
+
+	if cmd.state != nil {
+		res.ExitCode = cmd.state.ExitCode()
+		res.Signal = exitSignal(cmd.state)
+	}
+
+	if cmd.cgroup != nil {
+		res.OOMKilled = cmd.cgroup.OOMKilled()
+		cmd.cgroup.Remove()
+	}
+
+	finalStatus := Status{
+		Tag:    cmd.Tag,
+		ID:     cmd.ID,
+		Done:   true,
+		Result: res,
+	}
+
+	if err != nil {
+		finalStatus.Error = true
+		finalStatus.Message = err.Error()
+	}
+
+	cmd.m.Lock()
+	res.TimedOut = cmd.idleKilled || cmd.slowKilled > 0
+	cmd.m.Unlock()
+
+	switch {
+	case res.OOMKilled:
+		finalStatus.Error = true
+		finalStatus.Message = fmt.Sprintf("killed by the OOM killer (memory limit %v)", opts.memLimit)
+	case err == nil:
+	case !deadline.IsZero() && time.Now().After(deadline):
+		res.TimedOut = true
+		finalStatus.Message = "killed at the deadline"
+	case timeout > 0 && ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut = true
+		finalStatus.Message = fmt.Sprintf("killed after timeout of %v", timeout)
+	case res.StartFailed:
+		finalStatus.Message = "failed to start: " + err.Error()
+	}
+
+	return finalStatus
+}
+
+func worker(ctx context.Context, wg *sync.WaitGroup, slot int, sched *scheduler, outCh chan<- Status) {
+	defer wg.Done()
+
+	for {
+		if adaptive != nil {
+			adaptive.Acquire()
 		}
 
-		if err != nil {
-			finalStatus.Error = true
-			finalStatus.Message = err.Error()
+		cmd := sched.Next()
+		if cmd == nil {
+			if adaptive != nil {
+				adaptive.Abort()
+			}
+
+			return
 		}
 
-		outCh <- finalStatus
+		cmd.Slot = slot
+		finalStatus := runJob(ctx, cmd, outCh)
 
-		if cancel != nil {
-			cancel()
+		// only successful jobs are representative, killed or failing jobs
+		// would skew the median used for --timeout-factor
+		if finalStatus.Result != nil && !finalStatus.Error {
+			jobDurations.Add(finalStatus.Result.Duration)
 		}
+
+		if adaptive != nil {
+			if finalStatus.Result != nil {
+				adaptive.Release(finalStatus.Result.Duration, finalStatus.Error)
+			} else {
+				adaptive.Abort()
+			}
+		}
+
+		outCh <- finalStatus
+
+		sched.Done(cmd)
 	}
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchIdle(t *testing.T) {
+	t.Parallel()
+
+	const timeout = 150 * time.Millisecond
+
+	type write struct {
+		delay time.Duration
+		data  string
+	}
+
+	repeat := func(n int, w write) []write {
+		list := make([]write, n)
+		for i := range list {
+			list[i] = w
+		}
+
+		return list
+	}
+
+	var tests = []struct {
+		writes []write
+		killed bool
+	}{
+		// no output at all
+		{[]write{{300 * time.Millisecond, ""}}, true},
+		// lines printed regularly
+		{repeat(6, write{50 * time.Millisecond, "line\n"}), false},
+		// progress messages overwriting the same line
+		{repeat(6, write{50 * time.Millisecond, "50%\r"}), false},
+		// output at first, then silence
+		{append(repeat(3, write{50 * time.Millisecond, "line\n"}), write{300 * time.Millisecond, ""}), true},
+	}
+
+	for i, test := range tests {
+		i, test := i, test
+
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			c := &Command{Tag: "test", ID: i}
+			c.activity()
+
+			rd, wr := io.Pipe()
+			// large enough for all lines written in a test
+			out := make(chan Status, 10)
+
+			var outputWg sync.WaitGroup
+
+			outputWg.Add(1)
+
+			go c.tagLines(&outputWg, false, rd, out)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan struct{})
+
+			var wg sync.WaitGroup
+
+			wg.Add(1)
+
+			go c.watchIdle(&wg, done, cancel, timeout)
+
+			for _, w := range test.writes {
+				time.Sleep(w.delay)
+
+				if w.data != "" {
+					_, _ = wr.Write([]byte(w.data))
+				}
+			}
+
+			close(done)
+			wg.Wait()
+
+			_ = wr.Close()
+			outputWg.Wait()
+
+			killed := ctx.Err() != nil
+			if killed != test.killed || c.idleKilled != test.killed {
+				t.Errorf("test %d failed: want killed %v, got %v (idleKilled %v)", i, test.killed, killed, c.idleKilled)
+			}
+		})
+	}
+}
+
+func TestDrainOutputsDetach(t *testing.T) {
+	defer func(timeout time.Duration) {
+		opts.drainTimeout = timeout
+	}(opts.drainTimeout)
+
+	opts.drainTimeout = 100 * time.Millisecond
+
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Command{Tag: "test", ID: 1}
+	out := make(chan Status, 10)
+
+	var outputWg sync.WaitGroup
+
+	outputWg.Add(1)
+
+	go c.tagLines(&outputWg, false, rd, out)
+
+	_, err = wr.WriteString("before\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a background process keeps the write end open
+	start := time.Now()
+	c.drainOutputs(&outputWg, []output{{f: rd}})
+
+	if d := time.Since(start); d < opts.drainTimeout {
+		t.Errorf("drainOutputs returned after %v, before the timeout", d)
+	}
+
+	// writing must still succeed after the output has been detached
+	_, err = wr.WriteString("after\n")
+	if err != nil {
+		t.Fatalf("writing after detach failed: %v", err)
+	}
+
+	err = wr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputWg.Wait()
+	close(out)
+
+	var lines []string
+	for s := range out {
+		lines = append(lines, s.Message)
+	}
+
+	if len(lines) != 1 || lines[0] != "before" {
+		t.Errorf("want only the line printed before detaching, got %q", lines)
+	}
+}